@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"log"
 	"net/http"
 	"os"
@@ -14,6 +15,7 @@ import (
 	"Mmessenger/internal/database"
 	"Mmessenger/internal/handler"
 	"Mmessenger/internal/middleware"
+	"Mmessenger/internal/presence"
 	"Mmessenger/internal/pubsub"
 	"Mmessenger/internal/repository"
 	"Mmessenger/internal/service"
@@ -50,28 +52,39 @@ func main() {
 
 	log.Println("Database connection established")
 
-	// Connect to Redis
-	log.Printf("Connecting to Redis %s:%s...", cfg.Redis.Host, cfg.Redis.Port)
-	redisClient, err := database.NewRedis(&cfg.Redis)
-	if err != nil {
-		log.Fatalf("Failed to connect to Redis: %v", err)
-	}
-	defer redisClient.Close()
-
-	log.Println("Redis connection established")
-
-	// Initialize Redis Pub/Sub
-	redisPubSub := pubsub.NewRedisPubSub(redisClient)
-	if err := redisPubSub.Subscribe(context.Background(),
-		pubsub.ChannelRoomMessage,
-		pubsub.ChannelUserMessage,
-		pubsub.ChannelPresence,
-	); err != nil {
-		log.Fatalf("Failed to subscribe to Redis channels: %v", err)
+	// Initialize Pub/Sub and the presence store, in Redis unless running a single server
+	var broker pubsub.Broker
+	var presenceStore presence.Store
+	switch cfg.PubSub.Backend {
+	case config.PubSubBackendMemory:
+		broker = pubsub.NewMemoryBroker()
+		presenceStore = presence.NewMemoryStore(cfg.Presence.TTL)
+		log.Println("Using in-process Pub/Sub (single server only)")
+	case config.PubSubBackendRedis, config.PubSubBackendRedisStreams:
+		log.Printf("Connecting to Redis %s:%s...", cfg.Redis.Host, cfg.Redis.Port)
+		redisClient, err := database.NewRedis(&cfg.Redis)
+		if err != nil {
+			log.Fatalf("Failed to connect to Redis: %v", err)
+		}
+		defer redisClient.Close()
+
+		log.Println("Redis connection established")
+		presenceStore = presence.NewRedisStore(redisClient, cfg.Presence.TTL)
+		if cfg.PubSub.Backend == config.PubSubBackendRedisStreams {
+			broker = pubsub.NewRedisStreamBroker(redisClient, cfg.PubSub.StreamMaxLen, cfg.PubSub.StreamRetention)
+			log.Println("Using Redis Streams for Pub/Sub")
+		} else {
+			broker = pubsub.NewRedisPubSub(redisClient)
+		}
+	default:
+		log.Fatalf("Unknown PUBSUB_BACKEND %q (want %q, %q or %q)", cfg.PubSub.Backend,
+			config.PubSubBackendRedis, config.PubSubBackendRedisStreams, config.PubSubBackendMemory)
 	}
-	defer redisPubSub.Close()
 
-	log.Println("Redis Pub/Sub initialized")
+	// Room and user channels are subscribed by the hub as clients come and go
+	defer broker.Close()
+
+	log.Println("Pub/Sub initialized")
 
 	// Initialize file storage
 	log.Printf("Initializing file storage at %s...", cfg.Storage.BasePath)
@@ -95,6 +108,11 @@ func main() {
 	roomRepo := repository.NewRoomRepository(db)
 	messageRepo := repository.NewMessageRepository(db)
 	memberRepo := repository.NewRoomMemberRepository(db)
+	reactionRepo := repository.NewReactionRepository(db)
+	eventRepo := repository.NewEventRepository(db)
+	inviteRepo := repository.NewRoomInviteRepository(db)
+	pinRepo := repository.NewPinRepository(db)
+	mentionRepo := repository.NewMentionRepository(db)
 
 	// Initialize Keycloak service
 	keycloakService := keycloak.NewService(&cfg.Keycloak)
@@ -105,24 +123,31 @@ func main() {
 
 	// Initialize services
 	authService := service.NewAuthService(userRepo, db)
-	roomService := service.NewRoomService(roomRepo, memberRepo, userRepo, messageRepo)
-	messageService := service.NewMessageService(messageRepo, memberRepo, userRepo)
+	roomService := service.NewRoomService(roomRepo, memberRepo, userRepo, messageRepo, inviteRepo, &cfg.Room)
+	presenceService := service.NewPresenceService(presenceStore, userRepo, memberRepo, &cfg.Presence)
+	messageService := service.NewMessageService(messageRepo, memberRepo, userRepo, reactionRepo, roomRepo, pinRepo, mentionRepo, presenceService)
+	reactionService := service.NewReactionService(reactionRepo, messageRepo, memberRepo)
 	pushService := service.NewPushService(pushRepo, memberRepo, &cfg.WebPush)
+	eventService := service.NewEventService(eventRepo)
+	go eventService.RunRetention(context.Background())
 
 	// Initialize WebSocket Hub first (needed by RoomHandler)
-	hub := websocket.NewHub(redisPubSub)
+	hub := websocket.NewHub(broker, eventService, presenceService)
 	go hub.Run()
+	go presenceService.RunSweeper(context.Background(), cfg.Presence.TTL, hub.AnnouncePresence)
 
 	// Initialize handlers
 	authHandler := handler.NewAuthHandler(authService)
 	roomHandler := handler.NewRoomHandler(roomService, hub)
-	messageHandler := handler.NewMessageHandler(messageService)
+	messageHandler := handler.NewMessageHandler(messageService, hub)
+	reactionHandler := handler.NewReactionHandler(reactionService, hub)
 	userHandler := handler.NewUserHandler(userRepo)
 	fileHandler := handler.NewFileHandler(localStorage, cfg.Storage.MaxFileSize)
 	pushHandler := handler.NewPushHandler(pushService)
+	presenceHandler := handler.NewPresenceHandler(presenceService)
 
 	// Initialize WebSocket handler
-	wsHandler := websocket.NewHandler(hub, keycloakService, authService, messageService, pushService, memberRepo, userRepo, roomRepo, messageRepo)
+	wsHandler := websocket.NewHandler(hub, keycloakService, authService, messageService, reactionService, pushService, eventService, memberRepo, userRepo, roomRepo, messageRepo)
 
 	// User lookup function for auth middleware
 	userLookupFunc := func(ctx context.Context, keycloakClaims *keycloak.Claims) (*middleware.UserClaims, error) {
@@ -160,6 +185,14 @@ func main() {
 		w.Write([]byte(`{"status":"ok"}`))
 	}).Methods("GET")
 
+	// Stream transport health (protected), only with PUBSUB_BACKEND=redis-streams
+	if streams, ok := broker.(*pubsub.RedisStreamBroker); ok {
+		api.Handle("/health/pubsub", authMiddleware.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(streams.Stats())
+		}))).Methods("GET")
+	}
+
 	// Protected auth routes
 	authProtected := api.PathPrefix("/auth").Subrouter()
 	authProtected.Use(authMiddleware.Authenticate)
@@ -177,19 +210,64 @@ func main() {
 	roomRoutes.Use(authMiddleware.Authenticate)
 	roomRoutes.HandleFunc("", roomHandler.GetMyRooms).Methods("GET")
 	roomRoutes.HandleFunc("", roomHandler.Create).Methods("POST")
+	roomRoutes.HandleFunc("/discover", roomHandler.Discover).Methods("GET")
 	roomRoutes.HandleFunc("/{id:[0-9]+}", roomHandler.GetByID).Methods("GET")
 	roomRoutes.HandleFunc("/{id:[0-9]+}", roomHandler.Update).Methods("PUT")
 	roomRoutes.HandleFunc("/{id:[0-9]+}", roomHandler.Delete).Methods("DELETE")
+	roomRoutes.HandleFunc("/{id:[0-9]+}/settings", roomHandler.GetSettings).Methods("GET")
+	roomRoutes.HandleFunc("/{id:[0-9]+}/settings", roomHandler.UpdateSettings).Methods("PUT")
 	roomRoutes.HandleFunc("/{id:[0-9]+}/members", roomHandler.GetMembers).Methods("GET")
 	roomRoutes.HandleFunc("/{id:[0-9]+}/members", roomHandler.AddMember).Methods("POST")
 	roomRoutes.HandleFunc("/{id:[0-9]+}/members/{userId:[0-9]+}", roomHandler.RemoveMember).Methods("DELETE")
+	roomRoutes.HandleFunc("/{id:[0-9]+}/members/{userId:[0-9]+}/promote", roomHandler.PromoteMember).Methods("POST")
+	roomRoutes.HandleFunc("/{id:[0-9]+}/members/{userId:[0-9]+}/demote", roomHandler.DemoteMember).Methods("POST")
+	roomRoutes.HandleFunc("/{id:[0-9]+}/join", roomHandler.Join).Methods("POST")
 	roomRoutes.HandleFunc("/{id:[0-9]+}/leave", roomHandler.Leave).Methods("POST")
+	roomRoutes.HandleFunc("/{id:[0-9]+}/transfer-ownership", roomHandler.TransferOwnership).Methods("POST")
+	roomRoutes.HandleFunc("/{id:[0-9]+}/invites", roomHandler.ListInvites).Methods("GET")
+	roomRoutes.HandleFunc("/{id:[0-9]+}/invites", roomHandler.CreateInvite).Methods("POST")
+	roomRoutes.HandleFunc("/{id:[0-9]+}/invites/{inviteId:[0-9]+}", roomHandler.RevokeInvite).Methods("DELETE")
 
 	// Message routes (protected)
 	roomRoutes.HandleFunc("/{id:[0-9]+}/messages", messageHandler.GetMessages).Methods("GET")
+	roomRoutes.HandleFunc("/{id:[0-9]+}/pins", messageHandler.GetPins).Methods("GET")
+	roomRoutes.HandleFunc("/{id:[0-9]+}/pins/{msgId:[0-9]+}", messageHandler.Pin).Methods("PUT")
+	roomRoutes.HandleFunc("/{id:[0-9]+}/pins/{msgId:[0-9]+}", messageHandler.Unpin).Methods("DELETE")
 	roomRoutes.HandleFunc("/{id:[0-9]+}/messages/{msgId:[0-9]+}", messageHandler.GetMessage).Methods("GET")
 	roomRoutes.HandleFunc("/{id:[0-9]+}/messages/{msgId:[0-9]+}", messageHandler.Update).Methods("PUT")
 	roomRoutes.HandleFunc("/{id:[0-9]+}/messages/{msgId:[0-9]+}", messageHandler.Delete).Methods("DELETE")
+	roomRoutes.HandleFunc("/{id:[0-9]+}/messages/{msgId:[0-9]+}/thread", messageHandler.GetThread).Methods("GET")
+	roomRoutes.HandleFunc("/{id:[0-9]+}/messages/{msgId:[0-9]+}/revisions", messageHandler.GetRevisions).Methods("GET")
+	roomRoutes.HandleFunc("/{id:[0-9]+}/messages/{msgId:[0-9]+}/readers", messageHandler.GetReaders).Methods("GET")
+
+	// Reaction routes (protected)
+	roomRoutes.HandleFunc("/{id:[0-9]+}/messages/{msgId:[0-9]+}/reactions", reactionHandler.Add).Methods("POST")
+	roomRoutes.HandleFunc("/{id:[0-9]+}/messages/{msgId:[0-9]+}/reactions/{emoji}", reactionHandler.Remove).Methods("DELETE")
+
+	// Direct message routes (protected)
+	dmRoutes := api.PathPrefix("/dms").Subrouter()
+	dmRoutes.Use(authMiddleware.Authenticate)
+	dmRoutes.HandleFunc("", roomHandler.OpenDirect).Methods("POST")
+
+	// Invite routes (protected)
+	inviteRoutes := api.PathPrefix("/invites").Subrouter()
+	inviteRoutes.Use(authMiddleware.Authenticate)
+	inviteRoutes.HandleFunc("/{token}/accept", roomHandler.AcceptInvite).Methods("POST")
+
+	// Mention routes (protected)
+	mentionRoutes := api.PathPrefix("/mentions").Subrouter()
+	mentionRoutes.Use(authMiddleware.Authenticate)
+	mentionRoutes.HandleFunc("", messageHandler.GetMentions).Methods("GET")
+
+	// Presence routes (protected)
+	presenceRoutes := api.PathPrefix("/presence").Subrouter()
+	presenceRoutes.Use(authMiddleware.Authenticate)
+	presenceRoutes.HandleFunc("", presenceHandler.Get).Methods("GET")
+
+	// Search routes (protected)
+	searchRoutes := api.PathPrefix("/search").Subrouter()
+	searchRoutes.Use(authMiddleware.Authenticate)
+	searchRoutes.HandleFunc("/messages", messageHandler.Search).Methods("GET")
 
 	// File routes (protected)
 	fileRoutes := api.PathPrefix("/files").Subrouter()
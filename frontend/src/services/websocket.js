@@ -223,7 +223,9 @@ class WebSocketService {
     const payload = {
       room_id: roomId,
       content,
-      message_type: messageType
+      message_type: messageType,
+      // 재전송 시 서버가 중복 저장하지 않도록 클라이언트 메시지 ID를 붙인다
+      client_message_id: this.generateId()
     }
     if (fileUrl) {
       payload.file_url = fileUrl
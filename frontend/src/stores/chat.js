@@ -18,7 +18,8 @@ export const useChatStore = defineStore('chat', {
     offlineQueueCount: 0,
     // 무한 스크롤 관련
     loadingMore: false,
-    hasMore: {} // roomId별로 더 불러올 메시지가 있는지
+    hasMore: {}, // roomId별로 더 불러올 메시지가 있는지
+    nextCursor: {} // roomId별 이전 메시지 커서 (before_id)
   }),
 
   getters: {
@@ -98,14 +99,11 @@ export const useChatStore = defineStore('chat', {
         this.setUserTyping(payload.room_id, payload.user_id, payload.username, payload.is_typing)
       })
 
-      websocket.on('user_joined', (payload) => {
-        console.log('User joined room', payload)
-        this.updateRoomMemberCount(payload.room_id, payload.member_count)
-      })
-
-      websocket.on('user_left', (payload) => {
-        console.log('User left room', payload)
-        this.updateRoomMemberCount(payload.room_id, payload.member_count)
+      websocket.on('membership_changed', (payload) => {
+        const delta = { added: 1, removed: -1, left: -1 }[payload.action]
+        if (delta) {
+          this.adjustRoomMemberCount(payload.room_id, delta)
+        }
       })
 
       websocket.on('presence_update', (payload) => {
@@ -142,7 +140,9 @@ export const useChatStore = defineStore('chat', {
       this.loading = true
       try {
         const response = await api.get('/rooms')
-        this.rooms = response.data || []
+        // 1:1 대화는 그룹 채팅방과 따로 내려온다
+        const { rooms = [], direct_messages: directMessages = [] } = response.data || {}
+        this.rooms = [...directMessages, ...rooms]
       } catch (error) {
         this.error = error.response?.data?.error || 'Failed to fetch rooms'
       } finally {
@@ -150,24 +150,17 @@ export const useChatStore = defineStore('chat', {
       }
     },
 
-    async fetchMessages(roomId, limit = 50, offset = 0) {
+    async fetchMessages(roomId, limit = 50) {
       try {
         const response = await api.get(`/rooms/${roomId}/messages`, {
-          params: { limit, offset }
+          params: { limit }
         })
-        const messages = response.data || []
-
-        if (!this.messages[roomId]) {
-          this.messages[roomId] = []
-        }
+        const page = response.data || {}
 
-        if (offset === 0) {
-          this.messages[roomId] = messages
-          // 초기 로드 시 더 불러올 메시지가 있는지 확인
-          this.hasMore[roomId] = messages.length >= limit
-        } else {
-          this.messages[roomId] = [...messages, ...this.messages[roomId]]
-        }
+        this.messages[roomId] = page.messages || []
+        // 초기 로드 시 더 불러올 메시지가 있는지 확인
+        this.hasMore[roomId] = page.has_more
+        this.nextCursor[roomId] = page.next_cursor
       } catch (error) {
         console.error('Failed to fetch messages', error)
       }
@@ -187,13 +180,11 @@ export const useChatStore = defineStore('chat', {
       this.loadingMore = true
 
       try {
-        const limit = 50
-        const offset = currentMessages.length
-
         const response = await api.get(`/rooms/${roomId}/messages`, {
-          params: { limit, offset }
+          params: { limit: 50, before_id: this.nextCursor[roomId] }
         })
-        const olderMessages = response.data || []
+        const page = response.data || {}
+        const olderMessages = page.messages || []
 
         if (olderMessages.length > 0) {
           // 이전 메시지를 앞에 추가
@@ -201,7 +192,8 @@ export const useChatStore = defineStore('chat', {
         }
 
         // 더 불러올 메시지가 있는지 확인
-        this.hasMore[roomId] = olderMessages.length >= limit
+        this.hasMore[roomId] = page.has_more
+        this.nextCursor[roomId] = page.next_cursor
 
         return olderMessages.length > 0
       } catch (error) {
@@ -226,7 +218,7 @@ export const useChatStore = defineStore('chat', {
         const response = await api.get(`/rooms/${roomId}/messages`, {
           params: { after_id: lastMessageId, limit: 100 }
         })
-        const missedMessages = response.data || []
+        const missedMessages = response.data?.messages || []
 
         if (missedMessages.length > 0) {
           console.log(`Found ${missedMessages.length} missed messages`)
@@ -519,13 +511,13 @@ export const useChatStore = defineStore('chat', {
       }
     },
 
-    updateRoomMemberCount(roomId, memberCount) {
+    adjustRoomMemberCount(roomId, delta) {
       const room = this.rooms.find(r => r.id === roomId)
       if (room) {
-        room.member_count = memberCount
+        room.member_count += delta
       }
-      if (this.currentRoom?.id === roomId) {
-        this.currentRoom.member_count = memberCount
+      if (this.currentRoom?.id === roomId && this.currentRoom !== room) {
+        this.currentRoom.member_count += delta
       }
     },
 
@@ -599,6 +591,7 @@ export const useChatStore = defineStore('chat', {
       this.offlineQueueCount = 0
       this.loadingMore = false
       this.hasMore = {}
+      this.nextCursor = {}
       localStorage.removeItem('currentRoomId')
     }
   }
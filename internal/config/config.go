@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strconv"
 	"time"
@@ -12,11 +13,21 @@ type Config struct {
 	Server   ServerConfig
 	Database DatabaseConfig
 	Redis    RedisConfig
+	PubSub   PubSubConfig
+	Presence PresenceConfig
 	Storage  StorageConfig
 	JWT      JWTConfig
 	CORS     CORSConfig
 	Keycloak KeycloakConfig
 	WebPush  WebPushConfig
+	Room     RoomConfig
+}
+
+// RoomConfig bounds room capacity: new rooms start at DefaultMaxMembers and owners may
+// raise it up to MaxMembersLimit
+type RoomConfig struct {
+	DefaultMaxMembers int
+	MaxMembersLimit   int
 }
 
 type WebPushConfig struct {
@@ -54,6 +65,34 @@ type CORSConfig struct {
 	AllowedOrigins string
 }
 
+// Pub/sub backends
+const (
+	PubSubBackendRedis        = "redis"
+	PubSubBackendRedisStreams = "redis-streams"
+	PubSubBackendMemory       = "memory"
+)
+
+// PubSubConfig selects how hubs on different servers reach each other. The memory backend
+// needs no Redis but only works with a single server. The redis-streams backend keeps up to
+// StreamMaxLen entries per channel for StreamRetention, so servers can catch up after a
+// dropped connection.
+type PubSubConfig struct {
+	Backend         string
+	StreamMaxLen    int64
+	StreamRetention time.Duration
+}
+
+// PresenceConfig controls presence tracking: a connection that stops reporting for TTL is
+// considered gone, and a user with no activity for IdleTimeout on any connection is away
+type PresenceConfig struct {
+	TTL         time.Duration
+	IdleTimeout time.Duration
+}
+
+// presenceHeartbeat is how often a WebSocket connection renews its presence entry, the ping
+// period of the websocket package. A TTL at or below it would expire live connections.
+const presenceHeartbeat = 54 * time.Second
+
 type RedisConfig struct {
 	Host     string
 	Port     string
@@ -85,11 +124,51 @@ func Load() (*Config, error) {
 		redisDB = 0
 	}
 
+	streamMaxLen, err := strconv.ParseInt(getEnv("PUBSUB_STREAM_MAXLEN", "1000"), 10, 64)
+	if err != nil || streamMaxLen <= 0 {
+		streamMaxLen = 1000
+	}
+
+	streamRetention, err := time.ParseDuration(getEnv("PUBSUB_STREAM_RETENTION", "1h"))
+	if err != nil || streamRetention <= 0 {
+		streamRetention = time.Hour
+	}
+
+	presenceTTL, err := time.ParseDuration(getEnv("PRESENCE_TTL", "2m"))
+	if err != nil {
+		presenceTTL = 2 * time.Minute
+	}
+
+	idleTimeout, err := time.ParseDuration(getEnv("PRESENCE_IDLE_TIMEOUT", "5m"))
+	if err != nil {
+		idleTimeout = 5 * time.Minute
+	}
+
+	if presenceTTL <= presenceHeartbeat {
+		return nil, fmt.Errorf("PRESENCE_TTL must be longer than the %s presence heartbeat, got %s", presenceHeartbeat, presenceTTL)
+	}
+	if idleTimeout <= 0 {
+		return nil, fmt.Errorf("PRESENCE_IDLE_TIMEOUT must be positive, got %s", idleTimeout)
+	}
+
 	maxFileSize, err := strconv.ParseInt(getEnv("STORAGE_MAX_FILE_SIZE", "104857600"), 10, 64)
 	if err != nil {
 		maxFileSize = 100 * 1024 * 1024 // 100MB
 	}
 
+	maxMembersLimit, err := strconv.Atoi(getEnv("ROOM_MAX_MEMBERS_LIMIT", "1000"))
+	if err != nil {
+		maxMembersLimit = 1000
+	}
+
+	defaultMaxMembers, err := strconv.Atoi(getEnv("ROOM_DEFAULT_MAX_MEMBERS", "100"))
+	if err != nil {
+		defaultMaxMembers = 100
+	}
+	if defaultMaxMembers > maxMembersLimit {
+		defaultMaxMembers = maxMembersLimit
+	}
+
 	return &Config{
 		Server: ServerConfig{
 			Host: getEnv("SERVER_HOST", "localhost"),
@@ -108,6 +187,15 @@ func Load() (*Config, error) {
 			Password: getEnv("REDIS_PASSWORD", ""),
 			DB:       redisDB,
 		},
+		PubSub: PubSubConfig{
+			Backend:         getEnv("PUBSUB_BACKEND", PubSubBackendRedis),
+			StreamMaxLen:    streamMaxLen,
+			StreamRetention: streamRetention,
+		},
+		Presence: PresenceConfig{
+			TTL:         presenceTTL,
+			IdleTimeout: idleTimeout,
+		},
 		Storage: StorageConfig{
 			BasePath:    getEnv("STORAGE_BASE_PATH", "./uploads"),
 			MaxFileSize: maxFileSize,
@@ -131,6 +219,10 @@ func Load() (*Config, error) {
 			VAPIDPrivateKey: getEnv("VAPID_PRIVATE_KEY", ""),
 			VAPIDSubject:    getEnv("VAPID_SUBJECT", "mailto:admin@example.com"),
 		},
+		Room: RoomConfig{
+			DefaultMaxMembers: defaultMaxMembers,
+			MaxMembersLimit:   maxMembersLimit,
+		},
 	}, nil
 }
 
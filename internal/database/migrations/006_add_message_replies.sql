@@ -0,0 +1,6 @@
+-- Add reply/thread support to messages table
+ALTER TABLE messages
+    ADD COLUMN parent_id BIGINT UNSIGNED NULL AFTER sender_id,
+    ADD COLUMN thread_reply_count INT NOT NULL DEFAULT 0 AFTER thumbnail_url,
+    ADD CONSTRAINT fk_messages_parent FOREIGN KEY (parent_id) REFERENCES messages(id) ON DELETE SET NULL,
+    ADD INDEX idx_messages_parent (parent_id, id);
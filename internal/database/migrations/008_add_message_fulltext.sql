@@ -0,0 +1,3 @@
+-- Add FULLTEXT index for message search (ngram parser supports Korean/CJK)
+ALTER TABLE messages
+    ADD FULLTEXT INDEX ft_messages_content (content) WITH PARSER ngram;
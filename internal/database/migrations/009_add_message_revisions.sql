@@ -0,0 +1,15 @@
+-- Create message_revisions table to keep every previous version of an edited message
+CREATE TABLE IF NOT EXISTS message_revisions (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    message_id BIGINT UNSIGNED NOT NULL,
+    editor_id BIGINT UNSIGNED NOT NULL,
+    content TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+    FOREIGN KEY (editor_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_message_revisions_message (message_id, id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Optional per-room limit on how long after sending a message can be edited (NULL = no limit)
+ALTER TABLE rooms ADD COLUMN edit_window_seconds INT NULL AFTER max_members;
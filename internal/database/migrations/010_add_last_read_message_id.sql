@@ -0,0 +1,10 @@
+-- Track read position per member by message ID instead of timestamp
+ALTER TABLE room_members ADD COLUMN last_read_message_id BIGINT UNSIGNED NULL AFTER last_read_at;
+
+-- Backfill from last_read_at
+UPDATE room_members rm
+SET rm.last_read_message_id = (
+    SELECT MAX(m.id) FROM messages m
+    WHERE m.room_id = rm.room_id AND m.created_at <= rm.last_read_at
+)
+WHERE rm.last_read_at IS NOT NULL;
@@ -0,0 +1,3 @@
+-- Client-generated message ID for idempotent sends; unique per sender
+ALTER TABLE messages ADD COLUMN client_message_id VARCHAR(64) NULL AFTER sender_id;
+ALTER TABLE messages ADD UNIQUE KEY uk_messages_sender_client_id (sender_id, client_message_id);
@@ -0,0 +1,13 @@
+-- Create events table: log of delivered WebSocket events, replayed to clients on reconnect
+CREATE TABLE IF NOT EXISTS events (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    room_id BIGINT UNSIGNED NULL,
+    user_id BIGINT UNSIGNED NULL,
+    event_type VARCHAR(50) NOT NULL,
+    payload JSON NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    INDEX idx_events_room (room_id, id),
+    INDEX idx_events_user (user_id, id),
+    INDEX idx_events_created_at (created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,3 @@
+-- Canonical key of a 1:1 room ("<smaller user id>:<larger user id>"), so each pair has one room
+ALTER TABLE rooms ADD COLUMN dm_key VARCHAR(64) NULL AFTER room_type;
+ALTER TABLE rooms ADD UNIQUE KEY uk_rooms_dm_key (dm_key);
@@ -0,0 +1,2 @@
+-- Structured details of system messages (action, actor, target, old/new values)
+ALTER TABLE messages ADD COLUMN metadata JSON NULL AFTER thumbnail_url;
@@ -0,0 +1,23 @@
+-- Create room_invites table: shareable tokens that let users join a room
+CREATE TABLE IF NOT EXISTS room_invites (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    room_id BIGINT UNSIGNED NOT NULL,
+    token VARCHAR(64) NOT NULL,
+    created_by BIGINT UNSIGNED NOT NULL,
+    role ENUM('admin', 'member') DEFAULT 'member',
+    max_uses INT UNSIGNED NULL,
+    use_count INT UNSIGNED NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NULL,
+    revoked_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE,
+    FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE KEY uk_room_invites_token (token),
+    INDEX idx_room_invites_room (room_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Members who joined through an invite keep a reference to it
+ALTER TABLE room_members ADD COLUMN invite_id BIGINT UNSIGNED NULL AFTER role;
+ALTER TABLE room_members ADD CONSTRAINT fk_room_members_invite
+    FOREIGN KEY (invite_id) REFERENCES room_invites(id) ON DELETE SET NULL;
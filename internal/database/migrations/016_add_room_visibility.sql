@@ -0,0 +1,3 @@
+-- Public rooms are listed in the room directory and can be joined without an invite
+ALTER TABLE rooms ADD COLUMN visibility ENUM('private', 'public') NOT NULL DEFAULT 'private' AFTER room_type;
+ALTER TABLE rooms ADD INDEX idx_rooms_visibility (visibility, id);
@@ -0,0 +1,5 @@
+-- Per-member room settings: mute, archive and notification level
+ALTER TABLE room_members
+    ADD COLUMN muted_until TIMESTAMP NULL AFTER last_read_message_id,
+    ADD COLUMN archived BOOLEAN NOT NULL DEFAULT FALSE AFTER muted_until,
+    ADD COLUMN notification_level ENUM('all', 'mentions', 'none') NOT NULL DEFAULT 'all' AFTER archived;
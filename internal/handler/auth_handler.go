@@ -43,11 +43,5 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.authService.Logout(r.Context(), claims.UserID); err != nil {
-		log.Printf("[AuthHandler.Logout] Error: %v, UserID: %d", err, claims.UserID)
-		respondError(w, http.StatusInternalServerError, "Failed to logout")
-		return
-	}
-
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Logged out successfully"})
 }
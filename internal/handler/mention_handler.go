@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"Mmessenger/internal/middleware"
+)
+
+// GetMentions lists the messages that mentioned the requester, newest first
+func (h *MessageHandler) GetMentions(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	q := r.URL.Query()
+	limit := 20
+	if l := q.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 50 {
+			limit = parsed
+		}
+	}
+	// cursor: next_cursor from the previous page
+	var beforeID uint64
+	if v := q.Get("cursor"); v != "" {
+		var err error
+		if beforeID, err = strconv.ParseUint(v, 10, 64); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+	}
+
+	mentions, err := h.messageService.GetMentions(r.Context(), claims.UserID, beforeID, limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get mentions")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, mentions)
+}
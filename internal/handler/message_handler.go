@@ -5,21 +5,28 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 
 	"Mmessenger/internal/middleware"
 	"Mmessenger/internal/models"
 	"Mmessenger/internal/service"
+	"Mmessenger/internal/websocket"
 )
 
 type MessageHandler struct {
 	messageService *service.MessageService
+	hub            *websocket.Hub
 }
 
-func NewMessageHandler(messageService *service.MessageService) *MessageHandler {
-	return &MessageHandler{messageService: messageService}
+func NewMessageHandler(messageService *service.MessageService, hub *websocket.Hub) *MessageHandler {
+	return &MessageHandler{
+		messageService: messageService,
+		hub:            hub,
+	}
 }
 
 func (h *MessageHandler) GetMessages(w http.ResponseWriter, r *http.Request) {
@@ -36,52 +43,104 @@ func (h *MessageHandler) GetMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	limit := 50
-	offset := 0
-	var afterID uint64
+	cursor, badParam := parseMessageCursor(r.URL.Query())
+	if badParam != "" {
+		respondError(w, http.StatusBadRequest, "Invalid "+badParam)
+		return
+	}
 
-	if l := r.URL.Query().Get("limit"); l != "" {
-		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 100 {
-			limit = parsed
+	page, err := h.messageService.GetPage(r.Context(), roomID, claims.UserID, cursor)
+	if err != nil {
+		if errors.Is(err, service.ErrNotMember) {
+			respondError(w, http.StatusForbidden, "You are not a member of this room")
+			return
 		}
+		if errors.Is(err, service.ErrMessageNotFound) {
+			respondError(w, http.StatusNotFound, "Message not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to get messages")
+		return
 	}
 
-	if o := r.URL.Query().Get("offset"); o != "" {
-		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
-			offset = parsed
+	respondJSON(w, http.StatusOK, page)
+}
+
+// parseMessageCursor reads the history paging parameters. An out of range limit falls
+// back to the default; a malformed cursor ID is reported by its parameter name.
+func parseMessageCursor(q url.Values) (*models.MessageCursor, string) {
+	cursor := &models.MessageCursor{Limit: 50}
+
+	if l := q.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 100 {
+			cursor.Limit = parsed
 		}
 	}
 
-	// after_id: fetch messages after this ID (for reconnection scenarios)
-	if a := r.URL.Query().Get("after_id"); a != "" {
-		if parsed, err := strconv.ParseUint(a, 10, 64); err == nil {
-			afterID = parsed
+	// Cursors (at most one is used, in this order of precedence):
+	// around_id: jump to a message, e.g. from a search hit or push notification
+	// after_id: fetch newer messages (for reconnection scenarios)
+	// before_id: fetch older messages (scrolling back)
+	cursorParams := []struct {
+		name string
+		dest *uint64
+	}{
+		{"around_id", &cursor.AroundID},
+		{"after_id", &cursor.AfterID},
+		{"before_id", &cursor.BeforeID},
+	}
+	for _, p := range cursorParams {
+		if v := q.Get(p.name); v != "" {
+			parsed, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				return nil, p.name
+			}
+			*p.dest = parsed
+			break
 		}
 	}
 
-	var messages []*models.MessageResponse
+	return cursor, ""
+}
+
+func (h *MessageHandler) GetMessage(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	vars := mux.Vars(r)
+	roomID, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid room ID")
+		return
+	}
 
-	if afterID > 0 {
-		// Use after_id query (ignores offset)
-		messages, err = h.messageService.GetByRoomIDAfter(r.Context(), roomID, claims.UserID, afterID, limit)
-	} else {
-		// Use standard pagination
-		messages, err = h.messageService.GetByRoomID(r.Context(), roomID, claims.UserID, limit, offset)
+	msgID, err := strconv.ParseUint(vars["msgId"], 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid message ID")
+		return
 	}
 
+	message, err := h.messageService.GetByID(r.Context(), roomID, msgID, claims.UserID)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "Message not found")
+			return
+		}
 		if errors.Is(err, service.ErrNotMember) {
 			respondError(w, http.StatusForbidden, "You are not a member of this room")
 			return
 		}
-		respondError(w, http.StatusInternalServerError, "Failed to get messages")
+		respondError(w, http.StatusInternalServerError, "Failed to get message")
 		return
 	}
 
-	respondJSON(w, http.StatusOK, messages)
+	respondJSON(w, http.StatusOK, message)
 }
 
-func (h *MessageHandler) GetMessage(w http.ResponseWriter, r *http.Request) {
+func (h *MessageHandler) GetThread(w http.ResponseWriter, r *http.Request) {
 	claims := middleware.GetUserFromContext(r.Context())
 	if claims == nil {
 		respondError(w, http.StatusUnauthorized, "Unauthorized")
@@ -101,7 +160,23 @@ func (h *MessageHandler) GetMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	message, err := h.messageService.GetByID(r.Context(), roomID, msgID, claims.UserID)
+	limit := 50
+	var afterID uint64
+
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 100 {
+			limit = parsed
+		}
+	}
+
+	// after_id: fetch replies after this ID (next page)
+	if a := r.URL.Query().Get("after_id"); a != "" {
+		if parsed, err := strconv.ParseUint(a, 10, 64); err == nil {
+			afterID = parsed
+		}
+	}
+
+	thread, err := h.messageService.GetThread(r.Context(), roomID, msgID, claims.UserID, afterID, limit)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			respondError(w, http.StatusNotFound, "Message not found")
@@ -111,24 +186,113 @@ func (h *MessageHandler) GetMessage(w http.ResponseWriter, r *http.Request) {
 			respondError(w, http.StatusForbidden, "You are not a member of this room")
 			return
 		}
-		respondError(w, http.StatusInternalServerError, "Failed to get message")
+		respondError(w, http.StatusInternalServerError, "Failed to get thread")
 		return
 	}
 
-	respondJSON(w, http.StatusOK, message)
+	respondJSON(w, http.StatusOK, thread)
 }
 
-func (h *MessageHandler) Update(w http.ResponseWriter, r *http.Request) {
+func (h *MessageHandler) Search(w http.ResponseWriter, r *http.Request) {
 	claims := middleware.GetUserFromContext(r.Context())
 	if claims == nil {
 		respondError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	vars := mux.Vars(r)
-	msgID, err := strconv.ParseUint(vars["msgId"], 10, 64)
+	q := r.URL.Query()
+	filter := &models.MessageSearchFilter{
+		Query:       q.Get("q"),
+		MessageType: models.MessageType(q.Get("type")),
+		Limit:       20,
+	}
+
+	if filter.Query == "" {
+		respondError(w, http.StatusBadRequest, "Search query is required")
+		return
+	}
+
+	if l := q.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 50 {
+			filter.Limit = parsed
+		}
+	}
+
+	var err error
+	if v := q.Get("room_id"); v != "" {
+		if filter.RoomID, err = strconv.ParseUint(v, 10, 64); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid room ID")
+			return
+		}
+	}
+	if v := q.Get("sender_id"); v != "" {
+		if filter.SenderID, err = strconv.ParseUint(v, 10, 64); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid sender ID")
+			return
+		}
+	}
+	// cursor: next_cursor from the previous page
+	if v := q.Get("cursor"); v != "" {
+		if filter.BeforeID, err = strconv.ParseUint(v, 10, 64); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+	}
+	if v := q.Get("from"); v != "" {
+		from, err := parseSearchTime(v)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid from date")
+			return
+		}
+		filter.From = &from
+	}
+	if v := q.Get("to"); v != "" {
+		to, err := parseSearchTime(v)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid to date")
+			return
+		}
+		// A plain date includes the whole day
+		if len(v) == len(time.DateOnly) {
+			to = to.AddDate(0, 0, 1)
+		}
+		filter.To = &to
+	}
+
+	result, err := h.messageService.Search(r.Context(), claims.UserID, filter)
 	if err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid message ID")
+		if errors.Is(err, service.ErrEmptySearchTerm) {
+			respondError(w, http.StatusBadRequest, "Search query has no searchable terms")
+			return
+		}
+		if errors.Is(err, service.ErrNotMember) {
+			respondError(w, http.StatusForbidden, "You are not a member of this room")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to search messages")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, result)
+}
+
+// parseSearchTime accepts RFC 3339 timestamps or plain dates (YYYY-MM-DD, local time)
+func parseSearchTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(time.DateOnly, v, time.Local)
+}
+
+func (h *MessageHandler) Update(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	roomID, msgID, ok := parseRoomMessageIDs(w, r)
+	if !ok {
 		return
 	}
 
@@ -143,41 +307,133 @@ func (h *MessageHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	message, err := h.messageService.Update(r.Context(), msgID, claims.UserID, &req)
+	message, err := h.messageService.Update(r.Context(), roomID, msgID, claims.UserID, &req)
 	if err != nil {
+		if errors.Is(err, service.ErrMessageNotFound) {
+			respondError(w, http.StatusNotFound, "Message not found")
+			return
+		}
 		if errors.Is(err, service.ErrNotOwner) {
 			respondError(w, http.StatusForbidden, "You can only edit your own messages")
 			return
 		}
+		if errors.Is(err, service.ErrEditWindowPast) {
+			respondError(w, http.StatusForbidden, "The edit window for this message has passed")
+			return
+		}
+		if errors.Is(err, service.ErrSystemMessage) {
+			respondError(w, http.StatusForbidden, "System messages cannot be edited")
+			return
+		}
 		respondError(w, http.StatusInternalServerError, "Failed to update message")
 		return
 	}
 
+	if h.hub != nil {
+		h.hub.BroadcastMessageUpdated(message)
+	}
+
 	respondJSON(w, http.StatusOK, message)
 }
 
-func (h *MessageHandler) Delete(w http.ResponseWriter, r *http.Request) {
+func (h *MessageHandler) GetRevisions(w http.ResponseWriter, r *http.Request) {
 	claims := middleware.GetUserFromContext(r.Context())
 	if claims == nil {
 		respondError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	vars := mux.Vars(r)
-	msgID, err := strconv.ParseUint(vars["msgId"], 10, 64)
+	roomID, msgID, ok := parseRoomMessageIDs(w, r)
+	if !ok {
+		return
+	}
+
+	revisions, err := h.messageService.GetRevisions(r.Context(), roomID, msgID, claims.UserID)
 	if err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid message ID")
+		if errors.Is(err, service.ErrNotMember) {
+			respondError(w, http.StatusForbidden, "You are not a member of this room")
+			return
+		}
+		if errors.Is(err, service.ErrPermissionDenied) {
+			respondError(w, http.StatusForbidden, "You don't have permission to view edit history")
+			return
+		}
+		if errors.Is(err, service.ErrMessageNotFound) {
+			respondError(w, http.StatusNotFound, "Message not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to get message revisions")
 		return
 	}
 
-	if err := h.messageService.Delete(r.Context(), msgID, claims.UserID); err != nil {
-		if errors.Is(err, service.ErrNotOwner) {
-			respondError(w, http.StatusForbidden, "You can only delete your own messages")
+	respondJSON(w, http.StatusOK, revisions)
+}
+
+func (h *MessageHandler) GetReaders(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	roomID, msgID, ok := parseRoomMessageIDs(w, r)
+	if !ok {
+		return
+	}
+
+	readers, err := h.messageService.GetReaders(r.Context(), roomID, msgID, claims.UserID)
+	if err != nil {
+		if errors.Is(err, service.ErrNotMember) {
+			respondError(w, http.StatusForbidden, "You are not a member of this room")
+			return
+		}
+		if errors.Is(err, service.ErrMessageNotFound) {
+			respondError(w, http.StatusNotFound, "Message not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to get message readers")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, readers)
+}
+
+func (h *MessageHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	roomID, msgID, ok := parseRoomMessageIDs(w, r)
+	if !ok {
+		return
+	}
+
+	message, unpinned, err := h.messageService.Delete(r.Context(), roomID, msgID, claims.UserID)
+	if err != nil {
+		if errors.Is(err, service.ErrMessageNotFound) {
+			respondError(w, http.StatusNotFound, "Message not found")
+			return
+		}
+		if errors.Is(err, service.ErrNotMember) {
+			respondError(w, http.StatusForbidden, "You are not a member of this room")
+			return
+		}
+		if errors.Is(err, service.ErrPermissionDenied) {
+			respondError(w, http.StatusForbidden, "You don't have permission to delete others' messages")
 			return
 		}
 		respondError(w, http.StatusInternalServerError, "Failed to delete message")
 		return
 	}
 
+	if h.hub != nil {
+		h.hub.BroadcastMessageDeleted(message.RoomID, message.ID)
+		if unpinned {
+			h.hub.BroadcastMessageUnpinned(message.RoomID, message.ID, claims.UserID)
+		}
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
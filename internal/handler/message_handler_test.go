@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"net/url"
+	"testing"
+
+	"Mmessenger/internal/models"
+)
+
+func TestParseMessageCursor(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		want     models.MessageCursor
+		badParam string
+	}{
+		{"defaults", "", models.MessageCursor{Limit: 50}, ""},
+		{"limit", "limit=20", models.MessageCursor{Limit: 20}, ""},
+		{"limit too large", "limit=500", models.MessageCursor{Limit: 50}, ""},
+		{"limit not a number", "limit=abc", models.MessageCursor{Limit: 50}, ""},
+		{"before", "before_id=10", models.MessageCursor{BeforeID: 10, Limit: 50}, ""},
+		{"after", "after_id=10&limit=5", models.MessageCursor{AfterID: 10, Limit: 5}, ""},
+		{"around wins", "around_id=7&after_id=8&before_id=9", models.MessageCursor{AroundID: 7, Limit: 50}, ""},
+		{"after wins over before", "after_id=8&before_id=9", models.MessageCursor{AfterID: 8, Limit: 50}, ""},
+		{"invalid cursor", "before_id=-1", models.MessageCursor{}, "before_id"},
+		{"invalid preferred cursor", "around_id=x&before_id=9", models.MessageCursor{}, "around_id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cursor, badParam := parseMessageCursor(q)
+			if badParam != tt.badParam {
+				t.Fatalf("badParam = %q, want %q", badParam, tt.badParam)
+			}
+			if badParam != "" {
+				return
+			}
+			if *cursor != tt.want {
+				t.Errorf("cursor = %+v, want %+v", *cursor, tt.want)
+			}
+		})
+	}
+}
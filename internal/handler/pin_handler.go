@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"Mmessenger/internal/middleware"
+	"Mmessenger/internal/service"
+
+	"github.com/gorilla/mux"
+)
+
+func (h *MessageHandler) GetPins(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	roomID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid room ID")
+		return
+	}
+
+	pins, err := h.messageService.GetPins(r.Context(), roomID, claims.UserID)
+	if err != nil {
+		if errors.Is(err, service.ErrNotMember) {
+			respondError(w, http.StatusForbidden, "You are not a member of this room")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to get pinned messages")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, pins)
+}
+
+func (h *MessageHandler) Pin(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	roomID, msgID, ok := parseRoomMessageIDs(w, r)
+	if !ok {
+		return
+	}
+
+	pin, err := h.messageService.PinMessage(r.Context(), roomID, msgID, claims.UserID)
+	if err != nil {
+		if errors.Is(err, service.ErrNotMember) {
+			respondError(w, http.StatusForbidden, "You are not a member of this room")
+			return
+		}
+		if errors.Is(err, service.ErrPermissionDenied) {
+			respondError(w, http.StatusForbidden, "You don't have permission to pin messages")
+			return
+		}
+		if errors.Is(err, service.ErrMessageNotFound) {
+			respondError(w, http.StatusNotFound, "Message not found")
+			return
+		}
+		if errors.Is(err, service.ErrAlreadyPinned) {
+			respondError(w, http.StatusConflict, "Message is already pinned")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to pin message")
+		return
+	}
+
+	if h.hub != nil {
+		h.hub.BroadcastMessagePinned(pin)
+	}
+
+	respondJSON(w, http.StatusCreated, pin)
+}
+
+func (h *MessageHandler) Unpin(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	roomID, msgID, ok := parseRoomMessageIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.messageService.UnpinMessage(r.Context(), roomID, msgID, claims.UserID); err != nil {
+		if errors.Is(err, service.ErrNotMember) {
+			respondError(w, http.StatusForbidden, "You are not a member of this room")
+			return
+		}
+		if errors.Is(err, service.ErrPermissionDenied) {
+			respondError(w, http.StatusForbidden, "You don't have permission to unpin messages")
+			return
+		}
+		if errors.Is(err, service.ErrPinNotFound) {
+			respondError(w, http.StatusNotFound, "Message is not pinned")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to unpin message")
+		return
+	}
+
+	if h.hub != nil {
+		h.hub.BroadcastMessageUnpinned(roomID, msgID, claims.UserID)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
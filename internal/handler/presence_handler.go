@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"Mmessenger/internal/middleware"
+	"Mmessenger/internal/service"
+)
+
+type PresenceHandler struct {
+	presenceService *service.PresenceService
+}
+
+func NewPresenceHandler(presenceService *service.PresenceService) *PresenceHandler {
+	return &PresenceHandler{presenceService: presenceService}
+}
+
+// Get returns the presence of the users listed in ?ids=1,2,3 that the caller shares a room with
+func (h *PresenceHandler) Get(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var userIDs []uint64
+	seen := make(map[uint64]bool)
+	for _, field := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		userID, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+		if !seen[userID] {
+			seen[userID] = true
+			userIDs = append(userIDs, userID)
+		}
+	}
+	if len(userIDs) == 0 {
+		respondError(w, http.StatusBadRequest, "ids is required")
+		return
+	}
+
+	presence, err := h.presenceService.GetPresence(r.Context(), claims.UserID, userIDs)
+	if err != nil {
+		if errors.Is(err, service.ErrTooManyUsers) {
+			respondError(w, http.StatusBadRequest, "At most 100 users can be requested at once")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to get presence")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, presence)
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"Mmessenger/internal/middleware"
+	"Mmessenger/internal/models"
+	"Mmessenger/internal/service"
+	"Mmessenger/internal/websocket"
+)
+
+type ReactionHandler struct {
+	reactionService *service.ReactionService
+	hub             *websocket.Hub
+}
+
+func NewReactionHandler(reactionService *service.ReactionService, hub *websocket.Hub) *ReactionHandler {
+	return &ReactionHandler{
+		reactionService: reactionService,
+		hub:             hub,
+	}
+}
+
+func (h *ReactionHandler) Add(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	roomID, msgID, ok := parseRoomMessageIDs(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.ReactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	update, added, err := h.reactionService.Add(r.Context(), roomID, msgID, claims.UserID, req.Emoji)
+	if err != nil {
+		respondReactionError(w, err, "Failed to add reaction")
+		return
+	}
+
+	if h.hub != nil && added {
+		h.hub.BroadcastReactionUpdate(update)
+	}
+
+	respondJSON(w, http.StatusOK, update)
+}
+
+func (h *ReactionHandler) Remove(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	roomID, msgID, ok := parseRoomMessageIDs(w, r)
+	if !ok {
+		return
+	}
+
+	update, removed, err := h.reactionService.Remove(r.Context(), roomID, msgID, claims.UserID, mux.Vars(r)["emoji"])
+	if err != nil {
+		respondReactionError(w, err, "Failed to remove reaction")
+		return
+	}
+
+	if h.hub != nil && removed {
+		h.hub.BroadcastReactionUpdate(update)
+	}
+
+	respondJSON(w, http.StatusOK, update)
+}
+
+func respondReactionError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidEmoji):
+		respondError(w, http.StatusBadRequest, "Invalid emoji")
+	case errors.Is(err, service.ErrNotMember):
+		respondError(w, http.StatusForbidden, "You are not a member of this room")
+	case errors.Is(err, service.ErrMessageNotFound):
+		respondError(w, http.StatusNotFound, "Message not found")
+	default:
+		respondError(w, http.StatusInternalServerError, fallback)
+	}
+}
@@ -3,6 +3,9 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
 )
 
 type ErrorResponse struct {
@@ -20,3 +23,21 @@ func respondJSON(w http.ResponseWriter, status int, data interface{}) {
 func respondError(w http.ResponseWriter, status int, message string) {
 	respondJSON(w, status, ErrorResponse{Error: message})
 }
+
+// parseRoomMessageIDs reads the {id} and {msgId} route variables, responding with 400 on failure
+func parseRoomMessageIDs(w http.ResponseWriter, r *http.Request) (uint64, uint64, bool) {
+	vars := mux.Vars(r)
+	roomID, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid room ID")
+		return 0, 0, false
+	}
+
+	msgID, err := strconv.ParseUint(vars["msgId"], 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid message ID")
+		return 0, 0, false
+	}
+
+	return roomID, msgID, true
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 
@@ -48,6 +49,26 @@ func (h *RoomHandler) Create(w http.ResponseWriter, r *http.Request) {
 
 	room, err := h.roomService.Create(r.Context(), claims.UserID, &req)
 	if err != nil {
+		if errors.Is(err, service.ErrInvalidRoomType) {
+			respondError(w, http.StatusBadRequest, "Invalid room type; use /api/v1/dms for direct messages")
+			return
+		}
+		if errors.Is(err, service.ErrUserNotFound) {
+			respondError(w, http.StatusNotFound, "Invited user not found")
+			return
+		}
+		if errors.Is(err, service.ErrInvalidVisibility) {
+			respondError(w, http.StatusBadRequest, "Visibility must be public or private")
+			return
+		}
+		if errors.Is(err, service.ErrDuplicateInvitee) {
+			respondError(w, http.StatusBadRequest, "Each user can only be invited once")
+			return
+		}
+		if errors.Is(err, service.ErrRoomFull) {
+			respondError(w, http.StatusConflict, "Too many members for the room's capacity")
+			return
+		}
 		log.Printf("[RoomHandler.Create] Error: %v, UserID: %d", err, claims.UserID)
 		respondError(w, http.StatusInternalServerError, "Failed to create room")
 		return
@@ -56,6 +77,50 @@ func (h *RoomHandler) Create(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusCreated, room)
 }
 
+// OpenDirect returns the direct message room with another user, creating it on first use
+func (h *RoomHandler) OpenDirect(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req models.CreateDirectRoomRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == 0 {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	room, created, err := h.roomService.GetOrCreateDirect(r.Context(), claims.UserID, req.UserID)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidDirectPeer) {
+			respondError(w, http.StatusBadRequest, "Cannot start a direct message with yourself")
+			return
+		}
+		if errors.Is(err, service.ErrUserNotFound) {
+			respondError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		log.Printf("[RoomHandler.OpenDirect] Error: %v, UserID: %d", err, claims.UserID)
+		respondError(w, http.StatusInternalServerError, "Failed to open direct message")
+		return
+	}
+
+	if !created {
+		respondJSON(w, http.StatusOK, room)
+		return
+	}
+
+	// The peer sees the room named after the requester
+	if h.hub != nil {
+		if peerRoom, err := h.roomService.GetByID(r.Context(), room.ID, req.UserID); err == nil {
+			h.hub.SendRoomInvite(req.UserID, peerRoom)
+		}
+	}
+
+	respondJSON(w, http.StatusCreated, room)
+}
+
 func (h *RoomHandler) GetMyRooms(w http.ResponseWriter, r *http.Request) {
 	claims := middleware.GetUserFromContext(r.Context())
 	if claims == nil {
@@ -73,6 +138,81 @@ func (h *RoomHandler) GetMyRooms(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, rooms)
 }
 
+// Discover lists public rooms, optionally filtered by name or description
+func (h *RoomHandler) Discover(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	q := r.URL.Query()
+	filter := &models.RoomDirectoryFilter{
+		Query: strings.TrimSpace(q.Get("q")),
+		Limit: 20,
+	}
+
+	if l := q.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 50 {
+			filter.Limit = parsed
+		}
+	}
+	// cursor: next_cursor from the previous page
+	if v := q.Get("cursor"); v != "" {
+		var err error
+		if filter.BeforeID, err = strconv.ParseUint(v, 10, 64); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+	}
+
+	rooms, err := h.roomService.Discover(r.Context(), claims.UserID, filter)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list public rooms")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, rooms)
+}
+
+// Join adds the requester to a public room
+func (h *RoomHandler) Join(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	vars := mux.Vars(r)
+	roomID, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid room ID")
+		return
+	}
+
+	join, err := h.roomService.JoinPublic(r.Context(), roomID, claims.UserID)
+	if err != nil {
+		if errors.Is(err, service.ErrRoomNotFound) || errors.Is(err, service.ErrRoomNotPublic) {
+			respondError(w, http.StatusNotFound, "Public room not found")
+			return
+		}
+		if errors.Is(err, service.ErrAlreadyMember) {
+			respondError(w, http.StatusConflict, "You are already a member of this room")
+			return
+		}
+		if errors.Is(err, service.ErrRoomFull) {
+			respondError(w, http.StatusConflict, "Room is full")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to join room")
+		return
+	}
+
+	h.broadcastJoin(claims.UserID, join)
+
+	respondJSON(w, http.StatusOK, join)
+}
+
 func (h *RoomHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 	claims := middleware.GetUserFromContext(r.Context())
 	if claims == nil {
@@ -124,19 +264,114 @@ func (h *RoomHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	room, err := h.roomService.Update(r.Context(), roomID, claims.UserID, &req)
+	room, systemMessages, err := h.roomService.Update(r.Context(), roomID, claims.UserID, &req)
 	if err != nil {
-		if errors.Is(err, service.ErrNotOwner) {
-			respondError(w, http.StatusForbidden, "Only room owner can update")
+		if errors.Is(err, service.ErrNotMember) {
+			respondError(w, http.StatusForbidden, "You are not a member of this room")
+			return
+		}
+		if errors.Is(err, service.ErrPermissionDenied) {
+			respondError(w, http.StatusForbidden, "You don't have permission to edit this room")
+			return
+		}
+		if errors.Is(err, service.ErrInvalidEditWindow) {
+			respondError(w, http.StatusBadRequest, "Edit window must not be negative")
+			return
+		}
+		if errors.Is(err, service.ErrInvalidVisibility) {
+			respondError(w, http.StatusBadRequest, "Visibility must be public or private; direct messages stay private")
+			return
+		}
+		if errors.Is(err, service.ErrInvalidCapacity) {
+			respondError(w, http.StatusBadRequest, "Max members is outside the allowed range")
+			return
+		}
+		if errors.Is(err, service.ErrCapacityBelowMembers) {
+			respondError(w, http.StatusConflict, "Room already has more members than the new limit")
+			return
+		}
+		if errors.Is(err, service.ErrDirectRoomMembers) {
+			respondError(w, http.StatusBadRequest, "Direct message rooms have exactly two members")
 			return
 		}
 		respondError(w, http.StatusInternalServerError, "Failed to update room")
 		return
 	}
 
+	h.broadcastSystemMessages(systemMessages...)
+
 	respondJSON(w, http.StatusOK, room)
 }
 
+// GetSettings returns the requester's mute, archive and notification settings for the room
+func (h *RoomHandler) GetSettings(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	vars := mux.Vars(r)
+	roomID, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid room ID")
+		return
+	}
+
+	settings, err := h.roomService.GetSettings(r.Context(), roomID, claims.UserID)
+	if err != nil {
+		if errors.Is(err, service.ErrNotMember) {
+			respondError(w, http.StatusForbidden, "You are not a member of this room")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to get room settings")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, settings)
+}
+
+func (h *RoomHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	vars := mux.Vars(r)
+	roomID, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid room ID")
+		return
+	}
+
+	var req models.UpdateRoomSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	settings, err := h.roomService.UpdateSettings(r.Context(), roomID, claims.UserID, &req)
+	if err != nil {
+		if errors.Is(err, service.ErrNotMember) {
+			respondError(w, http.StatusForbidden, "You are not a member of this room")
+			return
+		}
+		if errors.Is(err, service.ErrInvalidMuteDuration) {
+			respondError(w, http.StatusBadRequest, "Mute duration must not be negative")
+			return
+		}
+		if errors.Is(err, service.ErrInvalidNotificationLevel) {
+			respondError(w, http.StatusBadRequest, "Notification level must be all, mentions or none")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to update room settings")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, settings)
+}
+
 func (h *RoomHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	claims := middleware.GetUserFromContext(r.Context())
 	if claims == nil {
@@ -152,7 +387,11 @@ func (h *RoomHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.roomService.Delete(r.Context(), roomID, claims.UserID); err != nil {
-		if errors.Is(err, service.ErrNotOwner) {
+		if errors.Is(err, service.ErrNotMember) {
+			respondError(w, http.StatusForbidden, "You are not a member of this room")
+			return
+		}
+		if errors.Is(err, service.ErrPermissionDenied) {
 			respondError(w, http.StatusForbidden, "Only room owner can delete")
 			return
 		}
@@ -210,11 +449,32 @@ func (h *RoomHandler) AddMember(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.roomService.AddMember(r.Context(), roomID, claims.UserID, req.UserID); err != nil {
+	systemMessage, err := h.roomService.AddMember(r.Context(), roomID, claims.UserID, req.UserID)
+	if err != nil {
 		if errors.Is(err, service.ErrNotMember) {
 			respondError(w, http.StatusForbidden, "You are not a member of this room")
 			return
 		}
+		if errors.Is(err, service.ErrPermissionDenied) {
+			respondError(w, http.StatusForbidden, "You don't have permission to invite members")
+			return
+		}
+		if errors.Is(err, service.ErrDirectRoomMembers) {
+			respondError(w, http.StatusBadRequest, "Direct message rooms have exactly two members")
+			return
+		}
+		if errors.Is(err, service.ErrUserNotFound) {
+			respondError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		if errors.Is(err, service.ErrAlreadyMember) {
+			respondError(w, http.StatusConflict, "User is already a member of this room")
+			return
+		}
+		if errors.Is(err, service.ErrRoomFull) {
+			respondError(w, http.StatusConflict, "Room is full")
+			return
+		}
 		respondError(w, http.StatusInternalServerError, "Failed to add member")
 		return
 	}
@@ -224,6 +484,10 @@ func (h *RoomHandler) AddMember(w http.ResponseWriter, r *http.Request) {
 	if err == nil && h.hub != nil {
 		h.hub.SendRoomInvite(req.UserID, room)
 	}
+	if h.hub != nil {
+		h.hub.BroadcastMembershipChanged(roomID, req.UserID, websocket.MembershipAdded)
+	}
+	h.broadcastSystemMessages(systemMessage)
 
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Member added successfully"})
 }
@@ -248,18 +512,142 @@ func (h *RoomHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.roomService.RemoveMember(r.Context(), roomID, claims.UserID, userID); err != nil {
-		if errors.Is(err, service.ErrNotOwner) {
-			respondError(w, http.StatusForbidden, "Only room owner can remove members")
+	systemMessage, err := h.roomService.RemoveMember(r.Context(), roomID, claims.UserID, userID)
+	if err != nil {
+		if errors.Is(err, service.ErrNotMember) {
+			respondError(w, http.StatusForbidden, "You are not a member of this room")
+			return
+		}
+		if errors.Is(err, service.ErrPermissionDenied) {
+			respondError(w, http.StatusForbidden, "You don't have permission to remove this member")
+			return
+		}
+		if errors.Is(err, service.ErrMemberNotFound) {
+			respondError(w, http.StatusNotFound, "User is not a member of this room")
+			return
+		}
+		if errors.Is(err, service.ErrDirectRoomMembers) {
+			respondError(w, http.StatusBadRequest, "Direct message rooms have exactly two members")
 			return
 		}
 		respondError(w, http.StatusInternalServerError, "Failed to remove member")
 		return
 	}
 
+	if h.hub != nil {
+		h.hub.BroadcastMembershipChanged(roomID, userID, websocket.MembershipRemoved)
+	}
+	h.broadcastSystemMessages(systemMessage)
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (h *RoomHandler) PromoteMember(w http.ResponseWriter, r *http.Request) {
+	h.setMemberRole(w, r, models.MemberRoleAdmin, websocket.MembershipPromoted)
+}
+
+func (h *RoomHandler) DemoteMember(w http.ResponseWriter, r *http.Request) {
+	h.setMemberRole(w, r, models.MemberRoleMember, websocket.MembershipDemoted)
+}
+
+func (h *RoomHandler) setMemberRole(w http.ResponseWriter, r *http.Request, role models.MemberRole, action string) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	vars := mux.Vars(r)
+	roomID, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid room ID")
+		return
+	}
+
+	userID, err := strconv.ParseUint(vars["userId"], 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	member, err := h.roomService.SetMemberRole(r.Context(), roomID, claims.UserID, userID, role)
+	if err != nil {
+		if errors.Is(err, service.ErrNotMember) {
+			respondError(w, http.StatusForbidden, "You are not a member of this room")
+			return
+		}
+		if errors.Is(err, service.ErrPermissionDenied) {
+			respondError(w, http.StatusForbidden, "You don't have permission to change this member's role")
+			return
+		}
+		if errors.Is(err, service.ErrMemberNotFound) {
+			respondError(w, http.StatusNotFound, "User is not a member of this room")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to change member role")
+		return
+	}
+
+	if h.hub != nil {
+		h.hub.BroadcastMembershipChanged(roomID, userID, action)
+	}
+
+	respondJSON(w, http.StatusOK, member)
+}
+
+func (h *RoomHandler) TransferOwnership(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	vars := mux.Vars(r)
+	roomID, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid room ID")
+		return
+	}
+
+	var req models.TransferOwnershipRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == 0 {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	transfer, err := h.roomService.TransferOwnership(r.Context(), roomID, claims.UserID, req.UserID)
+	if err != nil {
+		if errors.Is(err, service.ErrNotMember) {
+			respondError(w, http.StatusForbidden, "You are not a member of this room")
+			return
+		}
+		if errors.Is(err, service.ErrPermissionDenied) {
+			respondError(w, http.StatusForbidden, "Only room owner can transfer ownership")
+			return
+		}
+		if errors.Is(err, service.ErrInvalidTransferTarget) {
+			respondError(w, http.StatusBadRequest, "Ownership must be transferred to another member")
+			return
+		}
+		if errors.Is(err, service.ErrMemberNotFound) {
+			respondError(w, http.StatusNotFound, "User is not a member of this room")
+			return
+		}
+		if errors.Is(err, service.ErrOwnershipChanged) {
+			respondError(w, http.StatusConflict, "Room ownership changed, please try again")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to transfer ownership")
+		return
+	}
+
+	if h.hub != nil {
+		h.hub.BroadcastOwnershipTransferred(transfer)
+	}
+
+	respondJSON(w, http.StatusOK, transfer)
+}
+
 func (h *RoomHandler) Leave(w http.ResponseWriter, r *http.Request) {
 	claims := middleware.GetUserFromContext(r.Context())
 	if claims == nil {
@@ -274,14 +662,58 @@ func (h *RoomHandler) Leave(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.roomService.Leave(r.Context(), roomID, claims.UserID); err != nil {
+	// An owner may leave by handing the room to the oldest admin or member
+	transferOwnership := r.URL.Query().Get("transfer_ownership") == "true"
+
+	transfer, systemMessage, err := h.roomService.Leave(r.Context(), roomID, claims.UserID, transferOwnership)
+	if err != nil {
 		if errors.Is(err, service.ErrOwnerCannotLeave) {
-			respondError(w, http.StatusBadRequest, "Owner cannot leave the room. Delete it instead.")
+			respondError(w, http.StatusBadRequest, "Owner cannot leave the room. Transfer ownership or delete it instead.")
+			return
+		}
+		if errors.Is(err, service.ErrDirectRoomMembers) {
+			respondError(w, http.StatusBadRequest, "Direct message rooms cannot be left")
+			return
+		}
+		if errors.Is(err, service.ErrOwnershipChanged) {
+			respondError(w, http.StatusConflict, "Room ownership changed, please try again")
 			return
 		}
 		respondError(w, http.StatusInternalServerError, "Failed to leave room")
 		return
 	}
 
+	if h.hub != nil {
+		if transfer != nil {
+			h.hub.BroadcastOwnershipTransferred(transfer)
+		}
+		h.hub.BroadcastMembershipChanged(roomID, claims.UserID, websocket.MembershipLeft)
+	}
+	h.broadcastSystemMessages(systemMessage)
+
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Left room successfully"})
 }
+
+// broadcastSystemMessages delivers system messages written by the room service, skipping
+// any that failed to save
+func (h *RoomHandler) broadcastSystemMessages(messages ...*models.MessageResponse) {
+	if h.hub == nil {
+		return
+	}
+	for _, msg := range messages {
+		if msg != nil {
+			h.hub.BroadcastNewMessage(msg)
+		}
+	}
+}
+
+// broadcastJoin announces a user who joined a room by themselves: the user's other sessions
+// get the room, and the room gets user_joined, membership_changed and the system message
+func (h *RoomHandler) broadcastJoin(userID uint64, join *models.RoomJoin) {
+	if h.hub != nil {
+		room := join.Room
+		h.hub.SendRoomInvite(userID, room)
+		h.hub.BroadcastMembershipChanged(room.ID, userID, websocket.MembershipAdded)
+	}
+	h.broadcastSystemMessages(join.SystemMessage)
+}
@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"Mmessenger/internal/middleware"
+	"Mmessenger/internal/models"
+	"Mmessenger/internal/service"
+
+	"github.com/gorilla/mux"
+)
+
+func (h *RoomHandler) CreateInvite(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	vars := mux.Vars(r)
+	roomID, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid room ID")
+		return
+	}
+
+	var req models.CreateInviteRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	invite, err := h.roomService.CreateInvite(r.Context(), roomID, claims.UserID, &req)
+	if err != nil {
+		if errors.Is(err, service.ErrNotMember) {
+			respondError(w, http.StatusForbidden, "You are not a member of this room")
+			return
+		}
+		if errors.Is(err, service.ErrPermissionDenied) {
+			respondError(w, http.StatusForbidden, "You don't have permission to create this invite")
+			return
+		}
+		if errors.Is(err, service.ErrInvalidRole) {
+			respondError(w, http.StatusBadRequest, "Role must be admin or member")
+			return
+		}
+		if errors.Is(err, service.ErrInvalidInviteOptions) {
+			respondError(w, http.StatusBadRequest, "Max uses and expiry must be positive")
+			return
+		}
+		if errors.Is(err, service.ErrDirectRoomMembers) {
+			respondError(w, http.StatusBadRequest, "Direct message rooms have exactly two members")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to create invite")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, invite)
+}
+
+func (h *RoomHandler) ListInvites(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	vars := mux.Vars(r)
+	roomID, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid room ID")
+		return
+	}
+
+	invites, err := h.roomService.ListInvites(r.Context(), roomID, claims.UserID)
+	if err != nil {
+		if errors.Is(err, service.ErrNotMember) {
+			respondError(w, http.StatusForbidden, "You are not a member of this room")
+			return
+		}
+		if errors.Is(err, service.ErrPermissionDenied) {
+			respondError(w, http.StatusForbidden, "You don't have permission to manage invites")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to get invites")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, invites)
+}
+
+func (h *RoomHandler) RevokeInvite(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	vars := mux.Vars(r)
+	roomID, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid room ID")
+		return
+	}
+
+	inviteID, err := strconv.ParseUint(vars["inviteId"], 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid invite ID")
+		return
+	}
+
+	if err := h.roomService.RevokeInvite(r.Context(), roomID, inviteID, claims.UserID); err != nil {
+		if errors.Is(err, service.ErrNotMember) {
+			respondError(w, http.StatusForbidden, "You are not a member of this room")
+			return
+		}
+		if errors.Is(err, service.ErrPermissionDenied) {
+			respondError(w, http.StatusForbidden, "You don't have permission to manage invites")
+			return
+		}
+		if errors.Is(err, service.ErrInviteNotFound) {
+			respondError(w, http.StatusNotFound, "Invite not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to revoke invite")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *RoomHandler) AcceptInvite(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	token := mux.Vars(r)["token"]
+
+	join, err := h.roomService.AcceptInvite(r.Context(), token, claims.UserID)
+	if err != nil {
+		if errors.Is(err, service.ErrInviteNotFound) {
+			respondError(w, http.StatusNotFound, "Invite not found")
+			return
+		}
+		if errors.Is(err, service.ErrInviteExpired) {
+			respondError(w, http.StatusGone, "Invite has expired")
+			return
+		}
+		if errors.Is(err, service.ErrInviteExhausted) {
+			respondError(w, http.StatusGone, "Invite has reached its maximum uses")
+			return
+		}
+		if errors.Is(err, service.ErrAlreadyMember) {
+			respondError(w, http.StatusConflict, "You are already a member of this room")
+			return
+		}
+		if errors.Is(err, service.ErrRoomFull) {
+			respondError(w, http.StatusConflict, "Room is full")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to accept invite")
+		return
+	}
+
+	h.broadcastJoin(claims.UserID, join)
+
+	respondJSON(w, http.StatusOK, join)
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Event is a WebSocket event kept for replay after a reconnect.
+// RoomID targets every member of the room and UserID a single user; both may be set.
+// The ID doubles as the sequence number clients resume from.
+type Event struct {
+	ID        uint64          `json:"id"`
+	RoomID    sql.NullInt64   `json:"room_id"`
+	UserID    sql.NullInt64   `json:"user_id"`
+	EventType string          `json:"event_type"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+type MentionType string
+
+const (
+	// MentionTypeUser is an @username mention
+	MentionTypeUser MentionType = "user"
+	// MentionTypeHere mentions the room members who are online
+	MentionTypeHere MentionType = "here"
+	// MentionTypeAll mentions every room member
+	MentionTypeAll MentionType = "all"
+)
+
+// MessageMention records that a message mentions a user
+type MessageMention struct {
+	ID          uint64      `json:"id"`
+	MessageID   uint64      `json:"message_id"`
+	RoomID      uint64      `json:"room_id"`
+	UserID      uint64      `json:"user_id"`
+	MentionType MentionType `json:"mention_type"`
+	CreatedAt   time.Time   `json:"created_at"`
+}
+
+// MentionResponse is a mention as written in a message; User is set for @username mentions
+type MentionResponse struct {
+	Type MentionType   `json:"type"`
+	User *UserResponse `json:"user,omitempty"`
+}
+
+// MentionInboxItem is a message that mentioned the viewer
+type MentionInboxItem struct {
+	Message     *MessageResponse `json:"message"`
+	MentionType MentionType      `json:"mention_type"`
+	MentionedAt time.Time        `json:"mentioned_at"`
+}
+
+type MentionInboxResponse struct {
+	Mentions   []*MentionInboxItem `json:"mentions"`
+	NextCursor *string             `json:"next_cursor"`
+	HasMore    bool                `json:"has_more"`
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 )
 
@@ -15,31 +16,83 @@ const (
 	MessageTypeSticker MessageType = "sticker"
 )
 
+const deletedMessageContent = "This message has been deleted"
+
 type Message struct {
-	ID           uint64         `json:"id"`
-	RoomID       uint64         `json:"room_id"`
-	SenderID     uint64         `json:"sender_id"`
-	Content      string         `json:"content"`
-	MessageType  MessageType    `json:"message_type"`
-	FileURL      sql.NullString `json:"file_url"`
-	ThumbnailURL sql.NullString `json:"thumbnail_url"`
-	IsEdited     bool           `json:"is_edited"`
-	IsDeleted    bool           `json:"is_deleted"`
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
+	ID               uint64         `json:"id"`
+	RoomID           uint64         `json:"room_id"`
+	SenderID         uint64         `json:"sender_id"`
+	ClientMessageID  sql.NullString `json:"client_message_id"`
+	ParentID         sql.NullInt64  `json:"parent_id"`
+	Content          string         `json:"content"`
+	MessageType      MessageType    `json:"message_type"`
+	FileURL          sql.NullString `json:"file_url"`
+	ThumbnailURL     sql.NullString `json:"thumbnail_url"`
+	Metadata         sql.NullString `json:"metadata"`
+	ThreadReplyCount int            `json:"thread_reply_count"`
+	IsEdited         bool           `json:"is_edited"`
+	IsDeleted        bool           `json:"is_deleted"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
 }
 
 type MessageResponse struct {
-	ID           uint64        `json:"id"`
-	RoomID       uint64        `json:"room_id"`
-	Sender       *UserResponse `json:"sender"`
-	Content      string        `json:"content"`
-	MessageType  MessageType   `json:"message_type"`
-	FileURL      *string       `json:"file_url,omitempty"`
-	ThumbnailURL *string       `json:"thumbnail_url,omitempty"`
-	IsEdited     bool          `json:"is_edited"`
-	CreatedAt    time.Time     `json:"created_at"`
-	UnreadCount  int           `json:"unread_count"`
+	ID               uint64             `json:"id"`
+	RoomID           uint64             `json:"room_id"`
+	Sender           *UserResponse      `json:"sender"`
+	ClientMessageID  string             `json:"client_message_id,omitempty"`
+	Content          string             `json:"content"`
+	MessageType      MessageType        `json:"message_type"`
+	FileURL          *string            `json:"file_url,omitempty"`
+	ThumbnailURL     *string            `json:"thumbnail_url,omitempty"`
+	Metadata         json.RawMessage    `json:"metadata,omitempty"`
+	ParentID         *uint64            `json:"parent_id,omitempty"`
+	ReplyTo          *MessagePreview    `json:"reply_to,omitempty"`
+	ThreadReplyCount int                `json:"thread_reply_count"`
+	Reactions        []*ReactionSummary `json:"reactions,omitempty"`
+	Mentions         []*MentionResponse `json:"mentions,omitempty"`
+	IsEdited         bool               `json:"is_edited"`
+	EditedAt         *time.Time         `json:"edited_at,omitempty"`
+	CreatedAt        time.Time          `json:"created_at"`
+	UnreadCount      int                `json:"unread_count"`
+	// MentionedUserIDs lists everyone the message notifies as a mention; only set by MessageService.Create
+	MentionedUserIDs []uint64 `json:"-"`
+}
+
+// MessagePreview is the quoted parent shown above a reply
+type MessagePreview struct {
+	ID          uint64        `json:"id"`
+	Sender      *UserResponse `json:"sender"`
+	Content     string        `json:"content"`
+	MessageType MessageType   `json:"message_type"`
+	IsDeleted   bool          `json:"is_deleted"`
+}
+
+// MessageCursor selects a page of room history. At most one of the IDs is set;
+// with none set the newest messages are returned.
+type MessageCursor struct {
+	BeforeID uint64
+	AfterID  uint64
+	AroundID uint64
+	Limit    int
+}
+
+// MessagePage is a page of room history in chronological order.
+// NextCursor loads older messages (pass it as before_id) and PrevCursor loads
+// newer ones (pass it as after_id); each is null when nothing is left that way.
+// HasMore reports whether more messages exist in the direction requested.
+type MessagePage struct {
+	Messages   []*MessageResponse `json:"messages"`
+	NextCursor *string            `json:"next_cursor"`
+	PrevCursor *string            `json:"prev_cursor"`
+	HasMore    bool               `json:"has_more"`
+}
+
+// ThreadResponse is a page of replies to a parent message
+type ThreadResponse struct {
+	Parent  *MessageResponse   `json:"parent"`
+	Replies []*MessageResponse `json:"replies"`
+	HasMore bool               `json:"has_more"`
 }
 
 func (m *Message) ToResponse(sender *UserResponse, unreadCount int) *MessageResponse {
@@ -53,22 +106,63 @@ func (m *Message) ToResponse(sender *UserResponse, unreadCount int) *MessageResp
 		thumbnailURL = &m.ThumbnailURL.String
 	}
 
+	var parentID *uint64
+	if m.ParentID.Valid {
+		id := uint64(m.ParentID.Int64)
+		parentID = &id
+	}
+
 	content := m.Content
 	if m.IsDeleted {
-		content = "This message has been deleted"
+		content = deletedMessageContent
+	}
+
+	var editedAt *time.Time
+	if m.IsEdited {
+		editedAt = &m.UpdatedAt
+	}
+
+	var metadata json.RawMessage
+	if m.Metadata.Valid {
+		metadata = json.RawMessage(m.Metadata.String)
 	}
 
 	return &MessageResponse{
-		ID:           m.ID,
-		RoomID:       m.RoomID,
-		Sender:       sender,
-		Content:      content,
-		MessageType:  m.MessageType,
-		FileURL:      fileURL,
-		ThumbnailURL: thumbnailURL,
-		IsEdited:     m.IsEdited,
-		CreatedAt:    m.CreatedAt,
-		UnreadCount:  unreadCount,
+		ID:               m.ID,
+		RoomID:           m.RoomID,
+		Sender:           sender,
+		ClientMessageID:  m.ClientMessageID.String,
+		Content:          content,
+		MessageType:      m.MessageType,
+		FileURL:          fileURL,
+		ThumbnailURL:     thumbnailURL,
+		Metadata:         metadata,
+		ParentID:         parentID,
+		ThreadReplyCount: m.ThreadReplyCount,
+		IsEdited:         m.IsEdited,
+		EditedAt:         editedAt,
+		CreatedAt:        m.CreatedAt,
+		UnreadCount:      unreadCount,
+	}
+}
+
+// previewMaxLength caps the quoted text in a reply preview (in runes)
+const previewMaxLength = 100
+
+func (m *Message) ToPreview(sender *UserResponse) *MessagePreview {
+	content := m.Content
+	if m.IsDeleted {
+		content = deletedMessageContent
+	} else if runes := []rune(content); len(runes) > previewMaxLength {
+		content = string(runes[:previewMaxLength]) + "..."
+	}
+
+	return &MessagePreview{
+		ID:          m.ID,
+		Sender:      sender,
+		Content:     content,
+		MessageType: m.MessageType,
+		IsDeleted:   m.IsDeleted,
 	}
 }
 
@@ -77,6 +171,35 @@ type SendMessageRequest struct {
 	MessageType  MessageType `json:"message_type"`
 	FileURL      string      `json:"file_url,omitempty"`
 	ThumbnailURL string      `json:"thumbnail_url,omitempty"`
+	ParentID     uint64      `json:"parent_id,omitempty"`
+	// ClientMessageID deduplicates resends of the same message by its sender
+	ClientMessageID string `json:"client_message_id,omitempty"`
+}
+
+// MessageRevision is a previous version of an edited message.
+// CreatedAt is when the edit that replaced this content happened.
+type MessageRevision struct {
+	ID        uint64    `json:"id"`
+	MessageID uint64    `json:"message_id"`
+	EditorID  uint64    `json:"editor_id"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type MessageRevisionResponse struct {
+	ID       uint64        `json:"id"`
+	Editor   *UserResponse `json:"editor"`
+	Content  string        `json:"content"`
+	EditedAt time.Time     `json:"edited_at"`
+}
+
+func (r *MessageRevision) ToResponse(editor *UserResponse) *MessageRevisionResponse {
+	return &MessageRevisionResponse{
+		ID:       r.ID,
+		Editor:   editor,
+		Content:  r.Content,
+		EditedAt: r.CreatedAt,
+	}
 }
 
 type UpdateMessageRequest struct {
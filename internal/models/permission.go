@@ -0,0 +1,56 @@
+package models
+
+// Permission is a room action that depends on the member's role
+type Permission string
+
+const (
+	PermissionInvite               Permission = "invite"
+	PermissionKick                 Permission = "kick"
+	PermissionEditRoom             Permission = "edit_room"
+	PermissionPin                  Permission = "pin"
+	PermissionDeleteOthersMessages Permission = "delete_others_messages"
+	PermissionViewRevisions        Permission = "view_revisions"
+	PermissionManageRoles          Permission = "manage_roles"
+	PermissionDeleteRoom           Permission = "delete_room"
+	PermissionTransferOwnership    Permission = "transfer_ownership"
+	PermissionSetCapacity          Permission = "set_capacity"
+)
+
+var rolePermissions = map[MemberRole][]Permission{
+	MemberRoleOwner: {
+		PermissionInvite, PermissionKick, PermissionEditRoom, PermissionPin,
+		PermissionDeleteOthersMessages, PermissionViewRevisions, PermissionManageRoles, PermissionDeleteRoom,
+		PermissionTransferOwnership, PermissionSetCapacity,
+	},
+	MemberRoleAdmin: {
+		PermissionInvite, PermissionKick, PermissionEditRoom, PermissionPin,
+		PermissionDeleteOthersMessages, PermissionViewRevisions,
+	},
+	MemberRoleMember: {},
+}
+
+var roleRanks = map[MemberRole]int{
+	MemberRoleMember: 1,
+	MemberRoleAdmin:  2,
+	MemberRoleOwner:  3,
+}
+
+// Can reports whether the role grants the permission
+func (r MemberRole) Can(p Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Outranks reports whether the role is above other, e.g. an admin may kick members but not other admins
+func (r MemberRole) Outranks(other MemberRole) bool {
+	return roleRanks[r] > roleRanks[other]
+}
+
+// Permissions lists what the role grants
+func (r MemberRole) Permissions() []Permission {
+	return rolePermissions[r]
+}
@@ -0,0 +1,58 @@
+package models
+
+import "testing"
+
+func TestMemberRoleCan(t *testing.T) {
+	tests := []struct {
+		role       MemberRole
+		permission Permission
+		want       bool
+	}{
+		{MemberRoleOwner, PermissionInvite, true},
+		{MemberRoleOwner, PermissionManageRoles, true},
+		{MemberRoleOwner, PermissionDeleteRoom, true},
+		{MemberRoleAdmin, PermissionInvite, true},
+		{MemberRoleAdmin, PermissionKick, true},
+		{MemberRoleAdmin, PermissionEditRoom, true},
+		{MemberRoleAdmin, PermissionPin, true},
+		{MemberRoleAdmin, PermissionDeleteOthersMessages, true},
+		{MemberRoleAdmin, PermissionViewRevisions, true},
+		{MemberRoleAdmin, PermissionManageRoles, false},
+		{MemberRoleAdmin, PermissionDeleteRoom, false},
+		{MemberRoleMember, PermissionInvite, false},
+		{MemberRoleMember, PermissionPin, false},
+		{MemberRole("unknown"), PermissionInvite, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.role)+"/"+string(tt.permission), func(t *testing.T) {
+			if got := tt.role.Can(tt.permission); got != tt.want {
+				t.Errorf("%s.Can(%s) = %v, want %v", tt.role, tt.permission, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemberRoleOutranks(t *testing.T) {
+	tests := []struct {
+		role  MemberRole
+		other MemberRole
+		want  bool
+	}{
+		{MemberRoleOwner, MemberRoleAdmin, true},
+		{MemberRoleOwner, MemberRoleMember, true},
+		{MemberRoleAdmin, MemberRoleMember, true},
+		{MemberRoleAdmin, MemberRoleAdmin, false},
+		{MemberRoleAdmin, MemberRoleOwner, false},
+		{MemberRoleMember, MemberRoleMember, false},
+		{MemberRoleMember, MemberRole("unknown"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.role)+">"+string(tt.other), func(t *testing.T) {
+			if got := tt.role.Outranks(tt.other); got != tt.want {
+				t.Errorf("%s.Outranks(%s) = %v, want %v", tt.role, tt.other, got, tt.want)
+			}
+		})
+	}
+}
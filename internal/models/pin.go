@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// RoomPin marks a message as pinned in its room
+type RoomPin struct {
+	ID        uint64    `json:"id"`
+	RoomID    uint64    `json:"room_id"`
+	MessageID uint64    `json:"message_id"`
+	PinnedBy  uint64    `json:"pinned_by"`
+	PinnedAt  time.Time `json:"pinned_at"`
+}
+
+type PinnedMessageResponse struct {
+	Message  *MessageResponse `json:"message"`
+	PinnedBy *UserResponse    `json:"pinned_by"`
+	PinnedAt time.Time        `json:"pinned_at"`
+}
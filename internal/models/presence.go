@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// PresenceResponse is a user's current status across all servers
+type PresenceResponse struct {
+	UserID     uint64     `json:"user_id"`
+	Status     UserStatus `json:"status"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+}
+
+// PresenceChange is a status change to announce
+type PresenceChange struct {
+	UserID uint64
+	Status UserStatus
+}
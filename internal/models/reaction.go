@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+)
+
+type ReactionAction string
+
+const (
+	ReactionActionAdded   ReactionAction = "added"
+	ReactionActionRemoved ReactionAction = "removed"
+)
+
+// MessageReaction is a single user's emoji reaction to a message
+type MessageReaction struct {
+	ID        uint64    `json:"id"`
+	MessageID uint64    `json:"message_id"`
+	UserID    uint64    `json:"user_id"`
+	Emoji     string    `json:"emoji"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReactionSummary aggregates reactions of one emoji on a message
+type ReactionSummary struct {
+	Emoji       string `json:"emoji"`
+	Count       int    `json:"count"`
+	ReactedByMe bool   `json:"reacted_by_me"`
+}
+
+// ReactionUpdate describes a reaction change and the resulting counts.
+// ReactedByMe is never set here; clients derive it from UserID and Action.
+type ReactionUpdate struct {
+	RoomID    uint64             `json:"room_id"`
+	MessageID uint64             `json:"message_id"`
+	UserID    uint64             `json:"user_id"`
+	Emoji     string             `json:"emoji"`
+	Action    ReactionAction     `json:"action"`
+	Reactions []*ReactionSummary `json:"reactions"`
+}
+
+type ReactionRequest struct {
+	Emoji string `json:"emoji"`
+}
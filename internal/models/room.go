@@ -2,39 +2,78 @@ package models
 
 import (
 	"database/sql"
+	"fmt"
 	"time"
 )
 
 type RoomType string
 
 const (
+	// RoomTypePrivate is a direct message room between exactly two users
 	RoomTypePrivate RoomType = "private"
 	RoomTypeGroup   RoomType = "group"
 )
 
+// RoomVisibility controls whether a room appears in the room directory
+type RoomVisibility string
+
+const (
+	// RoomVisibilityPrivate rooms can only be joined by invitation
+	RoomVisibilityPrivate RoomVisibility = "private"
+	// RoomVisibilityPublic rooms are listed in the directory and anyone can join them
+	RoomVisibilityPublic RoomVisibility = "public"
+)
+
+// DirectRoomKey returns the canonical key of the direct message room between two users
+func DirectRoomKey(userA, userB uint64) string {
+	if userA > userB {
+		userA, userB = userB, userA
+	}
+	return fmt.Sprintf("%d:%d", userA, userB)
+}
+
 type Room struct {
-	ID          uint64         `json:"id"`
-	Name        string         `json:"name"`
-	Description sql.NullString `json:"description"`
-	RoomType    RoomType       `json:"room_type"`
-	OwnerID     uint64         `json:"owner_id"`
-	AvatarURL   sql.NullString `json:"avatar_url"`
-	MaxMembers  int            `json:"max_members"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
+	ID                uint64         `json:"id"`
+	Name              string         `json:"name"`
+	Description       sql.NullString `json:"description"`
+	RoomType          RoomType       `json:"room_type"`
+	Visibility        RoomVisibility `json:"visibility"`
+	DMKey             sql.NullString `json:"-"`
+	OwnerID           uint64         `json:"owner_id"`
+	AvatarURL         sql.NullString `json:"avatar_url"`
+	MaxMembers        int            `json:"max_members"`
+	EditWindowSeconds sql.NullInt64  `json:"edit_window_seconds"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
 }
 
 type RoomResponse struct {
-	ID          uint64    `json:"id"`
-	Name        string    `json:"name"`
-	Description *string   `json:"description"`
-	RoomType    RoomType  `json:"room_type"`
-	OwnerID     uint64    `json:"owner_id"`
-	AvatarURL   *string   `json:"avatar_url"`
-	MaxMembers  int       `json:"max_members"`
-	MemberCount int       `json:"member_count,omitempty"`
-	UnreadCount int       `json:"unread_count"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID                uint64         `json:"id"`
+	Name              string         `json:"name"`
+	Description       *string        `json:"description"`
+	RoomType          RoomType       `json:"room_type"`
+	Visibility        RoomVisibility `json:"visibility"`
+	OwnerID           uint64         `json:"owner_id"`
+	AvatarURL         *string        `json:"avatar_url"`
+	MaxMembers        int            `json:"max_members"`
+	MemberCount       int            `json:"member_count,omitempty"`
+	UnreadCount       int            `json:"unread_count"`
+	EditWindowSeconds *int64         `json:"edit_window_seconds"`
+	// Settings are the viewer's personal settings; only set in the room list
+	Settings *RoomSettings `json:"settings,omitempty"`
+	// DirectPeer is the other participant of a direct message room; Name and AvatarURL are taken from them
+	DirectPeer *UserResponse `json:"direct_peer,omitempty"`
+	CreatedAt  time.Time     `json:"created_at"`
+}
+
+// RoomListResponse lists a user's group rooms and direct messages separately
+type RoomListResponse struct {
+	Rooms          []*RoomResponse `json:"rooms"`
+	DirectMessages []*RoomResponse `json:"direct_messages"`
+}
+
+func (r *Room) IsDirect() bool {
+	return r.RoomType == RoomTypePrivate
 }
 
 func (r *Room) ToResponse() *RoomResponse {
@@ -46,33 +85,95 @@ func (r *Room) ToResponse() *RoomResponse {
 		avatarURL = &r.AvatarURL.String
 	}
 
+	var editWindow *int64
+	if r.EditWindowSeconds.Valid {
+		editWindow = &r.EditWindowSeconds.Int64
+	}
+
 	return &RoomResponse{
-		ID:          r.ID,
-		Name:        r.Name,
-		Description: description,
-		RoomType:    r.RoomType,
-		OwnerID:     r.OwnerID,
-		AvatarURL:   avatarURL,
-		MaxMembers:  r.MaxMembers,
-		CreatedAt:   r.CreatedAt,
+		ID:                r.ID,
+		Name:              r.Name,
+		Description:       description,
+		RoomType:          r.RoomType,
+		Visibility:        r.Visibility,
+		OwnerID:           r.OwnerID,
+		AvatarURL:         avatarURL,
+		MaxMembers:        r.MaxMembers,
+		EditWindowSeconds: editWindow,
+		CreatedAt:         r.CreatedAt,
 	}
 }
 
 // Getter methods for RoomResponse (used by websocket hub)
-func (r *RoomResponse) GetID() uint64          { return r.ID }
-func (r *RoomResponse) GetName() string        { return r.Name }
+func (r *RoomResponse) GetID() uint64           { return r.ID }
+func (r *RoomResponse) GetName() string         { return r.Name }
 func (r *RoomResponse) GetDescription() *string { return r.Description }
-func (r *RoomResponse) GetRoomType() string    { return string(r.RoomType) }
-func (r *RoomResponse) GetMemberCount() int    { return r.MemberCount }
+func (r *RoomResponse) GetRoomType() string     { return string(r.RoomType) }
+func (r *RoomResponse) GetMemberCount() int     { return r.MemberCount }
 
 type CreateRoomRequest struct {
-	Name        string   `json:"name"`
-	Description string   `json:"description,omitempty"`
-	RoomType    RoomType `json:"room_type"`
-	MemberIDs   []uint64 `json:"member_ids,omitempty"`
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	RoomType    RoomType       `json:"room_type"`
+	Visibility  RoomVisibility `json:"visibility,omitempty"`
+	MemberIDs   []uint64       `json:"member_ids,omitempty"`
+}
+
+// RoomDirectoryEntry is a public room as listed in the directory
+type RoomDirectoryEntry struct {
+	Room        *Room
+	MemberCount int
+	IsMember    bool
+}
+
+// RoomDirectoryFilter narrows the public room directory
+type RoomDirectoryFilter struct {
+	Query    string
+	BeforeID uint64 // cursor: only rooms older than this ID
+	Limit    int
+}
+
+type RoomDirectoryResult struct {
+	Room     *RoomResponse `json:"room"`
+	IsMember bool          `json:"is_member"`
+}
+
+type RoomDirectoryResponse struct {
+	Rooms      []*RoomDirectoryResult `json:"rooms"`
+	NextCursor *string                `json:"next_cursor"`
+	HasMore    bool                   `json:"has_more"`
+}
+
+type CreateDirectRoomRequest struct {
+	UserID uint64 `json:"user_id"`
+}
+
+type TransferOwnershipRequest struct {
+	UserID uint64 `json:"user_id"`
+}
+
+// OwnershipTransfer describes a completed ownership change and the system message recording it
+type OwnershipTransfer struct {
+	RoomID          uint64           `json:"room_id"`
+	PreviousOwnerID uint64           `json:"previous_owner_id"`
+	NewOwnerID      uint64           `json:"new_owner_id"`
+	SystemMessage   *MessageResponse `json:"system_message,omitempty"`
+}
+
+// RoomJoin describes a user joining a room by themselves, through an invite link or the
+// public directory, and the system message recording it
+type RoomJoin struct {
+	Room          *RoomResponse    `json:"room"`
+	Role          MemberRole       `json:"role"`
+	SystemMessage *MessageResponse `json:"system_message,omitempty"`
 }
 
+// UpdateRoomRequest changes only the fields that are set.
+// An EditWindowSeconds of 0 removes the room's edit time limit.
 type UpdateRoomRequest struct {
-	Name        *string `json:"name,omitempty"`
-	Description *string `json:"description,omitempty"`
+	Name              *string         `json:"name,omitempty"`
+	Description       *string         `json:"description,omitempty"`
+	EditWindowSeconds *int64          `json:"edit_window_seconds,omitempty"`
+	MaxMembers        *int            `json:"max_members,omitempty"`
+	Visibility        *RoomVisibility `json:"visibility,omitempty"`
 }
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// RoomInvite is a shareable token that adds whoever accepts it to the room with Role
+type RoomInvite struct {
+	ID        uint64        `json:"id"`
+	RoomID    uint64        `json:"room_id"`
+	Token     string        `json:"token"`
+	CreatedBy uint64        `json:"created_by"`
+	Role      MemberRole    `json:"role"`
+	MaxUses   sql.NullInt64 `json:"max_uses"`
+	UseCount  int           `json:"use_count"`
+	ExpiresAt sql.NullTime  `json:"expires_at"`
+	RevokedAt sql.NullTime  `json:"revoked_at"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// IsExpired reports whether the invite's expiry has passed
+func (i *RoomInvite) IsExpired(now time.Time) bool {
+	return i.ExpiresAt.Valid && !now.Before(i.ExpiresAt.Time)
+}
+
+// IsExhausted reports whether the invite has been used up
+func (i *RoomInvite) IsExhausted() bool {
+	return i.MaxUses.Valid && int64(i.UseCount) >= i.MaxUses.Int64
+}
+
+type RoomInviteResponse struct {
+	ID        uint64     `json:"id"`
+	RoomID    uint64     `json:"room_id"`
+	Token     string     `json:"token"`
+	CreatedBy uint64     `json:"created_by"`
+	Role      MemberRole `json:"role"`
+	MaxUses   *int64     `json:"max_uses"`
+	UseCount  int        `json:"use_count"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (i *RoomInvite) ToResponse() *RoomInviteResponse {
+	resp := &RoomInviteResponse{
+		ID:        i.ID,
+		RoomID:    i.RoomID,
+		Token:     i.Token,
+		CreatedBy: i.CreatedBy,
+		Role:      i.Role,
+		UseCount:  i.UseCount,
+		CreatedAt: i.CreatedAt,
+	}
+	if i.MaxUses.Valid {
+		resp.MaxUses = &i.MaxUses.Int64
+	}
+	if i.ExpiresAt.Valid {
+		resp.ExpiresAt = &i.ExpiresAt.Time
+	}
+	return resp
+}
+
+// CreateInviteRequest configures a new invite; unset limits mean the invite never expires
+// or runs out. Role defaults to member.
+type CreateInviteRequest struct {
+	Role             MemberRole `json:"role,omitempty"`
+	MaxUses          *int64     `json:"max_uses,omitempty"`
+	ExpiresInSeconds *int64     `json:"expires_in_seconds,omitempty"`
+}
@@ -13,13 +13,64 @@ const (
 	MemberRoleMember MemberRole = "member"
 )
 
+// NotificationLevel decides which messages in a room notify the member
+type NotificationLevel string
+
+const (
+	NotificationLevelAll      NotificationLevel = "all"
+	NotificationLevelMentions NotificationLevel = "mentions"
+	NotificationLevelNone     NotificationLevel = "none"
+)
+
 type RoomMember struct {
-	ID         uint64       `json:"id"`
-	RoomID     uint64       `json:"room_id"`
-	UserID     uint64       `json:"user_id"`
-	Role       MemberRole   `json:"role"`
-	JoinedAt   time.Time    `json:"joined_at"`
-	LastReadAt sql.NullTime `json:"last_read_at"`
+	ID                uint64            `json:"id"`
+	RoomID            uint64            `json:"room_id"`
+	UserID            uint64            `json:"user_id"`
+	Role              MemberRole        `json:"role"`
+	InviteID          sql.NullInt64     `json:"invite_id"`
+	JoinedAt          time.Time         `json:"joined_at"`
+	LastReadAt        sql.NullTime      `json:"last_read_at"`
+	LastReadMessageID sql.NullInt64     `json:"last_read_message_id"`
+	MutedUntil        sql.NullTime      `json:"muted_until"`
+	Archived          bool              `json:"archived"`
+	NotificationLevel NotificationLevel `json:"notification_level"`
+}
+
+// IsMuted reports whether the member has muted the room at the given time
+func (m *RoomMember) IsMuted(now time.Time) bool {
+	return m.MutedUntil.Valid && now.Before(m.MutedUntil.Time)
+}
+
+// Settings returns the member's personal settings for the room
+func (m *RoomMember) Settings() *RoomSettings {
+	settings := &RoomSettings{
+		Archived:          m.Archived,
+		NotificationLevel: m.NotificationLevel,
+	}
+	if m.IsMuted(time.Now()) {
+		settings.MutedUntil = &m.MutedUntil.Time
+	}
+	return settings
+}
+
+// RoomSettings are a member's personal settings for a room
+type RoomSettings struct {
+	MutedUntil        *time.Time        `json:"muted_until"`
+	Archived          bool              `json:"archived"`
+	NotificationLevel NotificationLevel `json:"notification_level"`
+}
+
+// UpdateRoomSettingsRequest changes only the fields that are set.
+// MuteForSeconds mutes the room for that long; 0 unmutes it.
+type UpdateRoomSettingsRequest struct {
+	MuteForSeconds    *int64             `json:"mute_for_seconds,omitempty"`
+	Archived          *bool              `json:"archived,omitempty"`
+	NotificationLevel *NotificationLevel `json:"notification_level,omitempty"`
+}
+
+// HasRead reports whether the member's read position covers the message
+func (m *RoomMember) HasRead(messageID uint64) bool {
+	return m.LastReadMessageID.Valid && uint64(m.LastReadMessageID.Int64) >= messageID
 }
 
 type RoomMemberResponse struct {
@@ -31,3 +82,10 @@ type RoomMemberResponse struct {
 type AddMemberRequest struct {
 	UserID uint64 `json:"user_id"`
 }
+
+// ReadReceiptResponse lists who has and hasn't read a message (the sender is excluded)
+type ReadReceiptResponse struct {
+	MessageID uint64          `json:"message_id"`
+	ReadBy    []*UserResponse `json:"read_by"`
+	UnreadBy  []*UserResponse `json:"unread_by"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import "testing"
+
+func TestDirectRoomKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		userA uint64
+		userB uint64
+		want  string
+	}{
+		{"ordered", 1, 2, "1:2"},
+		{"reversed", 2, 1, "1:2"},
+		{"same user", 7, 7, "7:7"},
+		{"numeric not lexical order", 10, 9, "9:10"},
+		{"large ids", 18446744073709551615, 42, "42:18446744073709551615"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DirectRoomKey(tt.userA, tt.userB); got != tt.want {
+				t.Errorf("DirectRoomKey(%d, %d) = %q, want %q", tt.userA, tt.userB, got, tt.want)
+			}
+			if got := DirectRoomKey(tt.userB, tt.userA); got != tt.want {
+				t.Errorf("DirectRoomKey(%d, %d) = %q, want %q", tt.userB, tt.userA, got, tt.want)
+			}
+		})
+	}
+}
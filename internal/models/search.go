@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+// MessageSearchFilter narrows a full-text message search
+type MessageSearchFilter struct {
+	Query       string
+	RoomID      uint64
+	SenderID    uint64
+	MessageType MessageType
+	From        *time.Time
+	To          *time.Time
+	BeforeID    uint64 // cursor: only messages older than this ID
+	Limit       int
+}
+
+// HighlightRange marks a matched term in a snippet, as rune offsets [Start, End)
+type HighlightRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+type MessageSearchResult struct {
+	Message    *MessageResponse `json:"message"`
+	Snippet    string           `json:"snippet"`
+	Highlights []HighlightRange `json:"highlights"`
+}
+
+type MessageSearchResponse struct {
+	Results    []*MessageSearchResult `json:"results"`
+	NextCursor *string                `json:"next_cursor"`
+	HasMore    bool                   `json:"has_more"`
+}
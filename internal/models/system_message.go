@@ -0,0 +1,32 @@
+package models
+
+// SystemAction is the change a system message records
+type SystemAction string
+
+const (
+	SystemActionMemberAdded          SystemAction = "member_added"
+	SystemActionMemberRemoved        SystemAction = "member_removed"
+	SystemActionMemberJoined         SystemAction = "member_joined"
+	SystemActionMemberLeft           SystemAction = "member_left"
+	SystemActionRoomRenamed          SystemAction = "room_renamed"
+	SystemActionDescriptionChanged   SystemAction = "description_changed"
+	SystemActionOwnershipTransferred SystemAction = "ownership_transferred"
+)
+
+// SystemUser identifies a user in system message metadata, with their name at the time
+type SystemUser struct {
+	ID       uint64 `json:"id"`
+	Username string `json:"username"`
+}
+
+// SystemMessageMetadata describes a system message so clients can render it in their own language.
+// Target is set for membership and ownership changes (the inviter for joins through an invite),
+// OldValue and NewValue for room edits.
+type SystemMessageMetadata struct {
+	Action   SystemAction `json:"action"`
+	Actor    *SystemUser  `json:"actor"`
+	Target   *SystemUser  `json:"target,omitempty"`
+	OldValue *string      `json:"old_value,omitempty"`
+	NewValue *string      `json:"new_value,omitempty"`
+	InviteID *uint64      `json:"invite_id,omitempty"`
+}
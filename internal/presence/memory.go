@@ -0,0 +1,95 @@
+package presence
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"Mmessenger/internal/models"
+)
+
+// MemoryStore is a Store for a single server
+type MemoryStore struct {
+	ttl       time.Duration
+	mu        sync.Mutex
+	conns     map[uint64]map[string]memoryConn
+	announced map[uint64]models.UserStatus
+}
+
+type memoryConn struct {
+	status    models.UserStatus
+	expiresAt time.Time
+}
+
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{
+		ttl:       ttl,
+		conns:     make(map[uint64]map[string]memoryConn),
+		announced: make(map[uint64]models.UserStatus),
+	}
+}
+
+func (s *MemoryStore) Touch(ctx context.Context, userID uint64, connID string, status models.UserStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conns, ok := s.conns[userID]
+	if !ok {
+		conns = make(map[string]memoryConn)
+		s.conns[userID] = conns
+	}
+	conns[connID] = memoryConn{status: status, expiresAt: time.Now().Add(s.ttl)}
+	return nil
+}
+
+func (s *MemoryStore) Remove(ctx context.Context, userID uint64, connID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if conns, ok := s.conns[userID]; ok {
+		delete(conns, connID)
+		if len(conns) == 0 {
+			delete(s.conns, userID)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Statuses(ctx context.Context, userIDs []uint64) (map[uint64]models.UserStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	statuses := statusesFor(userIDs)
+	for _, userID := range userIDs {
+		conns := s.conns[userID]
+		for connID, conn := range conns {
+			if now.After(conn.expiresAt) {
+				delete(conns, connID)
+				continue
+			}
+			statuses[userID] = combine(statuses[userID], conn.status)
+		}
+		if conns != nil && len(conns) == 0 {
+			delete(s.conns, userID)
+		}
+	}
+	return statuses, nil
+}
+
+func (s *MemoryStore) Announce(ctx context.Context, userID uint64, status models.UserStatus) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.announced[userID]
+	if !ok {
+		previous = models.UserStatusOffline
+	}
+	// Offline users are dropped so the map only holds users who are around
+	if status == models.UserStatusOffline {
+		delete(s.announced, userID)
+	} else {
+		s.announced[userID] = status
+	}
+	return previous != status, nil
+}
@@ -0,0 +1,176 @@
+package presence
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"Mmessenger/internal/models"
+)
+
+func TestCombine(t *testing.T) {
+	tests := []struct {
+		name    string
+		current models.UserStatus
+		conn    models.UserStatus
+		want    models.UserStatus
+	}{
+		{"first connection online", models.UserStatusOffline, models.UserStatusOnline, models.UserStatusOnline},
+		{"first connection away", models.UserStatusOffline, models.UserStatusAway, models.UserStatusAway},
+		{"online wins over away", models.UserStatusAway, models.UserStatusOnline, models.UserStatusOnline},
+		{"online stays online", models.UserStatusOnline, models.UserStatusAway, models.UserStatusOnline},
+		{"all away", models.UserStatusAway, models.UserStatusAway, models.UserStatusAway},
+		{"nothing connected", models.UserStatusOffline, models.UserStatusOffline, models.UserStatusOffline},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := combine(tt.current, tt.conn); got != tt.want {
+				t.Errorf("combine(%q, %q) = %q, want %q", tt.current, tt.conn, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreStatuses(t *testing.T) {
+	type touch struct {
+		userID uint64
+		connID string
+		status models.UserStatus
+	}
+	tests := []struct {
+		name    string
+		touches []touch
+		removes []touch
+		want    map[uint64]models.UserStatus
+	}{
+		{
+			name: "no connections",
+			want: map[uint64]models.UserStatus{1: models.UserStatusOffline},
+		},
+		{
+			name:    "one online connection",
+			touches: []touch{{1, "a", models.UserStatusOnline}},
+			want:    map[uint64]models.UserStatus{1: models.UserStatusOnline},
+		},
+		{
+			name: "one tab idle, one active",
+			touches: []touch{
+				{1, "a", models.UserStatusAway},
+				{1, "b", models.UserStatusOnline},
+			},
+			want: map[uint64]models.UserStatus{1: models.UserStatusOnline},
+		},
+		{
+			name: "every tab idle",
+			touches: []touch{
+				{1, "a", models.UserStatusAway},
+				{1, "b", models.UserStatusAway},
+			},
+			want: map[uint64]models.UserStatus{1: models.UserStatusAway},
+		},
+		{
+			name: "active tab closed",
+			touches: []touch{
+				{1, "a", models.UserStatusAway},
+				{1, "b", models.UserStatusOnline},
+			},
+			removes: []touch{{userID: 1, connID: "b"}},
+			want:    map[uint64]models.UserStatus{1: models.UserStatusAway},
+		},
+		{
+			name:    "last connection closed",
+			touches: []touch{{1, "a", models.UserStatusOnline}},
+			removes: []touch{{userID: 1, connID: "a"}},
+			want:    map[uint64]models.UserStatus{1: models.UserStatusOffline},
+		},
+		{
+			name: "users are independent",
+			touches: []touch{
+				{1, "a", models.UserStatusOnline},
+				{2, "a", models.UserStatusAway},
+			},
+			want: map[uint64]models.UserStatus{
+				1: models.UserStatusOnline,
+				2: models.UserStatusAway,
+				3: models.UserStatusOffline,
+			},
+		},
+	}
+
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore(time.Minute)
+			for _, c := range tt.touches {
+				store.Touch(ctx, c.userID, c.connID, c.status)
+			}
+			for _, c := range tt.removes {
+				store.Remove(ctx, c.userID, c.connID)
+			}
+
+			userIDs := make([]uint64, 0, len(tt.want))
+			for userID := range tt.want {
+				userIDs = append(userIDs, userID)
+			}
+			got, err := store.Statuses(ctx, userIDs)
+			if err != nil {
+				t.Fatalf("Statuses() error = %v", err)
+			}
+			for userID, want := range tt.want {
+				if got[userID] != want {
+					t.Errorf("status of user %d = %q, want %q", userID, got[userID], want)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(time.Millisecond)
+	store.Touch(ctx, 1, "a", models.UserStatusOnline)
+	time.Sleep(5 * time.Millisecond)
+
+	got, err := store.Statuses(ctx, []uint64{1})
+	if err != nil {
+		t.Fatalf("Statuses() error = %v", err)
+	}
+	if got[1] != models.UserStatusOffline {
+		t.Errorf("status after TTL = %q, want %q", got[1], models.UserStatusOffline)
+	}
+	if _, ok := store.conns[1]; ok {
+		t.Error("expired connection was not dropped")
+	}
+}
+
+func TestMemoryStoreAnnounce(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(time.Minute)
+
+	steps := []struct {
+		status models.UserStatus
+		want   bool
+	}{
+		{models.UserStatusOffline, false}, // never announced counts as offline
+		{models.UserStatusOnline, true},
+		{models.UserStatusOnline, false},
+		{models.UserStatusAway, true},
+		{models.UserStatusOnline, true},
+		{models.UserStatusOffline, true},
+		{models.UserStatusOffline, false},
+	}
+
+	for i, step := range steps {
+		changed, err := store.Announce(ctx, 1, step.status)
+		if err != nil {
+			t.Fatalf("step %d: Announce() error = %v", i, err)
+		}
+		if changed != step.want {
+			t.Errorf("step %d: Announce(%q) = %v, want %v", i, step.status, changed, step.want)
+		}
+	}
+	if _, ok := store.announced[1]; ok {
+		t.Error("offline user was kept in the announced map")
+	}
+}
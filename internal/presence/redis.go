@@ -0,0 +1,112 @@
+package presence
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"Mmessenger/internal/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore is a Store shared by every server. Each user has a hash of connection ID to
+// "status|expiry"; the hash itself expires once no connection has reported for a TTL.
+type RedisStore struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+func NewRedisStore(client *redis.Client, ttl time.Duration) *RedisStore {
+	return &RedisStore{client: client, ttl: ttl}
+}
+
+func presenceKey(userID uint64) string {
+	return "presence:" + strconv.FormatUint(userID, 10)
+}
+
+func announcedKey(userID uint64) string {
+	return "presence:announced:" + strconv.FormatUint(userID, 10)
+}
+
+func (s *RedisStore) Touch(ctx context.Context, userID uint64, connID string, status models.UserStatus) error {
+	key := presenceKey(userID)
+	value := string(status) + "|" + strconv.FormatInt(time.Now().Add(s.ttl).UnixMilli(), 10)
+
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, connID, value)
+		pipe.PExpire(ctx, key, s.ttl)
+		return nil
+	})
+	return err
+}
+
+func (s *RedisStore) Remove(ctx context.Context, userID uint64, connID string) error {
+	return s.client.HDel(ctx, presenceKey(userID), connID).Err()
+}
+
+// Statuses reads every user's connections in one round trip. Connections past their
+// expiry, left behind by a server that stopped without removing them, are dropped.
+func (s *RedisStore) Statuses(ctx context.Context, userIDs []uint64) (map[uint64]models.UserStatus, error) {
+	statuses := statusesFor(userIDs)
+	if len(userIDs) == 0 {
+		return statuses, nil
+	}
+
+	cmds := make([]*redis.MapStringStringCmd, len(userIDs))
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, userID := range userIDs {
+			cmds[i] = pipe.HGetAll(ctx, presenceKey(userID))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UnixMilli()
+	expired := make(map[uint64][]string)
+	for i, userID := range userIDs {
+		for connID, value := range cmds[i].Val() {
+			status, expiry, _ := strings.Cut(value, "|")
+			if expiresAt, err := strconv.ParseInt(expiry, 10, 64); err != nil || expiresAt < now {
+				expired[userID] = append(expired[userID], connID)
+				continue
+			}
+			statuses[userID] = combine(statuses[userID], models.UserStatus(status))
+		}
+	}
+
+	if len(expired) > 0 {
+		s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for userID, connIDs := range expired {
+				pipe.HDel(ctx, presenceKey(userID), connIDs...)
+			}
+			return nil
+		})
+	}
+	return statuses, nil
+}
+
+// Announce swaps the announced status in one command, so when servers race to announce the
+// same change only one of them sees it as new. Offline is stored as no key at all.
+func (s *RedisStore) Announce(ctx context.Context, userID uint64, status models.UserStatus) (bool, error) {
+	key := announcedKey(userID)
+
+	var previous string
+	var err error
+	if status == models.UserStatusOffline {
+		previous, err = s.client.GetDel(ctx, key).Result()
+	} else {
+		previous, err = s.client.SetArgs(ctx, key, string(status), redis.SetArgs{Get: true}).Result()
+	}
+	if errors.Is(err, redis.Nil) {
+		previous, err = string(models.UserStatusOffline), nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return previous != string(status), nil
+}
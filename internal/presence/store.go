@@ -0,0 +1,52 @@
+// Package presence tracks which users are connected anywhere in the cluster.
+package presence
+
+import (
+	"context"
+
+	"Mmessenger/internal/models"
+)
+
+// Store records the live connections of each user. A connection reports its status
+// (online or away) periodically and is forgotten once it stops reporting for longer than
+// the store's TTL, so users of a crashed server go offline on their own.
+type Store interface {
+	// Touch records that the connection is alive with the given status
+	Touch(ctx context.Context, userID uint64, connID string, status models.UserStatus) error
+	// Remove forgets a closed connection
+	Remove(ctx context.Context, userID uint64, connID string) error
+	// Statuses returns the combined status of each user; users without live connections
+	// are offline
+	Statuses(ctx context.Context, userIDs []uint64) (map[uint64]models.UserStatus, error)
+	// Announce records status as the last one announced for the user, shared by every
+	// server, and reports whether it differs from the previous one. Users never announced
+	// count as offline.
+	Announce(ctx context.Context, userID uint64, status models.UserStatus) (bool, error)
+}
+
+var (
+	_ Store = (*RedisStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
+
+// combine folds the statuses of a user's connections: online if any connection is
+// online, away if all of them are idle, offline if there are none
+func combine(current, conn models.UserStatus) models.UserStatus {
+	switch {
+	case current == models.UserStatusOnline || conn == models.UserStatusOnline:
+		return models.UserStatusOnline
+	case current == models.UserStatusAway || conn == models.UserStatusAway:
+		return models.UserStatusAway
+	default:
+		return models.UserStatusOffline
+	}
+}
+
+// statusesFor returns a map with every user offline, ready to be combined into
+func statusesFor(userIDs []uint64) map[uint64]models.UserStatus {
+	statuses := make(map[uint64]models.UserStatus, len(userIDs))
+	for _, userID := range userIDs {
+		statuses[userID] = models.UserStatusOffline
+	}
+	return statuses
+}
@@ -0,0 +1,78 @@
+package pubsub
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ChannelRoomPrefix starts the channel of each room, see RoomChannel
+	ChannelRoomPrefix = "room:"
+	// ChannelUserPrefix starts the channel of each user, see UserChannel
+	ChannelUserPrefix = "user:"
+)
+
+// RoomChannel is the channel carrying events for one room
+func RoomChannel(roomID uint64) string {
+	return ChannelRoomPrefix + strconv.FormatUint(roomID, 10)
+}
+
+// UserChannel is the channel carrying events for one user's connections
+func UserChannel(userID uint64) string {
+	return ChannelUserPrefix + strconv.FormatUint(userID, 10)
+}
+
+// Broker relays hub traffic between server instances. Messages a broker publishes are not
+// delivered back to the same broker; the hub has already delivered them locally.
+type Broker interface {
+	// Subscribe starts delivering messages on the channels to their OnMessage handlers.
+	// It may be called again to add channels.
+	Subscribe(ctx context.Context, channels ...string) error
+	// Unsubscribe stops delivering messages on the channels
+	Unsubscribe(ctx context.Context, channels ...string) error
+	// OnMessage registers the handler for a channel, or for every channel starting with a
+	// prefix such as ChannelRoomPrefix; call it before Subscribe
+	OnMessage(channel string, handler func(*Message))
+	Publish(ctx context.Context, channel string, msg *Message) error
+	PublishRoomMessage(ctx context.Context, roomID uint64, payload []byte) error
+	PublishUserMessage(ctx context.Context, userID uint64, payload []byte) error
+	Close() error
+}
+
+var (
+	_ Broker = (*RedisPubSub)(nil)
+	_ Broker = (*MemoryBroker)(nil)
+	_ Broker = (*RedisStreamBroker)(nil)
+)
+
+// handlerFor finds the handler registered for channel itself or, failing that, for its
+// prefix up to and including the last ':'
+func handlerFor(handlers map[string]func(*Message), channel string) (func(*Message), bool) {
+	if handler, ok := handlers[channel]; ok {
+		return handler, true
+	}
+	if i := strings.LastIndexByte(channel, ':'); i >= 0 {
+		handler, ok := handlers[channel[:i+1]]
+		return handler, ok
+	}
+	return nil, false
+}
+
+func newRoomMessage(serverID string, roomID uint64, payload []byte) *Message {
+	return &Message{
+		Type:     "room_message",
+		ServerID: serverID,
+		RoomID:   roomID,
+		Payload:  payload,
+	}
+}
+
+func newUserMessage(serverID string, userID uint64, payload []byte) *Message {
+	return &Message{
+		Type:     "user_message",
+		ServerID: serverID,
+		UserID:   userID,
+		Payload:  payload,
+	}
+}
@@ -0,0 +1,156 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// memoryInboxSize bounds the deliveries queued for a MemoryBroker before publishers block
+const memoryInboxSize = 256
+
+// MemoryBroker is an in-process Broker for running a single server without Redis.
+// Brokers made with NewPeer share its bus, so several hubs in one process can stand in
+// for a cluster.
+type MemoryBroker struct {
+	bus      *memoryBus
+	serverID string
+
+	mu         sync.RWMutex
+	handlers   map[string]func(*Message)
+	subscribed map[string]bool
+
+	inbox     chan memoryDelivery
+	listening sync.Once
+	done      chan struct{}
+	closed    sync.Once
+}
+
+type memoryBus struct {
+	mu      sync.RWMutex
+	brokers map[*MemoryBroker]bool
+}
+
+type memoryDelivery struct {
+	channel string
+	msg     *Message
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return newMemoryBroker(&memoryBus{brokers: make(map[*MemoryBroker]bool)})
+}
+
+// NewPeer returns a broker for another server on the same in-process bus
+func (b *MemoryBroker) NewPeer() *MemoryBroker {
+	return newMemoryBroker(b.bus)
+}
+
+func newMemoryBroker(bus *memoryBus) *MemoryBroker {
+	b := &MemoryBroker{
+		bus:        bus,
+		serverID:   uuid.New().String(),
+		handlers:   make(map[string]func(*Message)),
+		subscribed: make(map[string]bool),
+		inbox:      make(chan memoryDelivery, memoryInboxSize),
+		done:       make(chan struct{}),
+	}
+
+	bus.mu.Lock()
+	bus.brokers[b] = true
+	bus.mu.Unlock()
+	return b
+}
+
+func (b *MemoryBroker) Subscribe(ctx context.Context, channels ...string) error {
+	b.mu.Lock()
+	for _, channel := range channels {
+		b.subscribed[channel] = true
+	}
+	b.mu.Unlock()
+
+	b.listening.Do(func() {
+		go b.listen(ctx)
+	})
+	return nil
+}
+
+func (b *MemoryBroker) Unsubscribe(ctx context.Context, channels ...string) error {
+	b.mu.Lock()
+	for _, channel := range channels {
+		delete(b.subscribed, channel)
+	}
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *MemoryBroker) listen(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-b.done:
+			return
+		case d := <-b.inbox:
+			b.mu.RLock()
+			handler, ok := handlerFor(b.handlers, d.channel)
+			b.mu.RUnlock()
+			if ok {
+				handler(d.msg)
+			}
+		}
+	}
+}
+
+func (b *MemoryBroker) OnMessage(channel string, handler func(*Message)) {
+	b.mu.Lock()
+	b.handlers[channel] = handler
+	b.mu.Unlock()
+}
+
+// Publish hands msg to every broker on the bus subscribed to channel, except the one
+// whose server sent it
+func (b *MemoryBroker) Publish(ctx context.Context, channel string, msg *Message) error {
+	b.bus.mu.RLock()
+	defer b.bus.mu.RUnlock()
+
+	for peer := range b.bus.brokers {
+		if peer.serverID == msg.ServerID || !peer.isSubscribed(channel) {
+			continue
+		}
+
+		m := *msg
+		select {
+		case peer.inbox <- memoryDelivery{channel: channel, msg: &m}:
+		case <-peer.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (b *MemoryBroker) isSubscribed(channel string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.subscribed[channel]
+}
+
+func (b *MemoryBroker) PublishRoomMessage(ctx context.Context, roomID uint64, payload []byte) error {
+	return b.Publish(ctx, RoomChannel(roomID), newRoomMessage(b.serverID, roomID, payload))
+}
+
+func (b *MemoryBroker) PublishUserMessage(ctx context.Context, userID uint64, payload []byte) error {
+	return b.Publish(ctx, UserChannel(userID), newUserMessage(b.serverID, userID, payload))
+}
+
+// Close detaches the broker from the bus and stops delivery
+func (b *MemoryBroker) Close() error {
+	b.closed.Do(func() {
+		b.bus.mu.Lock()
+		delete(b.bus.brokers, b)
+		b.bus.mu.Unlock()
+		close(b.done)
+	})
+	return nil
+}
@@ -4,17 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"log"
+	"sync"
 
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 )
 
-const (
-	ChannelRoomMessage = "room:message"
-	ChannelUserMessage = "user:message"
-	ChannelPresence    = "presence"
-)
-
 type Message struct {
 	Type     string          `json:"type"`
 	ServerID string          `json:"server_id"`
@@ -25,6 +20,7 @@ type Message struct {
 
 type RedisPubSub struct {
 	client   *redis.Client
+	mu       sync.Mutex
 	pubsub   *redis.PubSub
 	serverID string
 	handlers map[string]func(*Message)
@@ -38,7 +34,15 @@ func NewRedisPubSub(client *redis.Client) *RedisPubSub {
 	}
 }
 
+// Subscribe adds channels to the subscription. The first call opens it and starts the
+// listener, which runs until ctx is done.
 func (r *RedisPubSub) Subscribe(ctx context.Context, channels ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.pubsub != nil {
+		return r.pubsub.Subscribe(ctx, channels...)
+	}
 	r.pubsub = r.client.Subscribe(ctx, channels...)
 
 	_, err := r.pubsub.Receive(ctx)
@@ -50,6 +54,16 @@ func (r *RedisPubSub) Subscribe(ctx context.Context, channels ...string) error {
 	return nil
 }
 
+func (r *RedisPubSub) Unsubscribe(ctx context.Context, channels ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.pubsub == nil {
+		return nil
+	}
+	return r.pubsub.Unsubscribe(ctx, channels...)
+}
+
 func (r *RedisPubSub) listen(ctx context.Context) {
 	ch := r.pubsub.Channel()
 
@@ -78,7 +92,7 @@ func (r *RedisPubSub) handleMessage(msg *redis.Message) {
 		return
 	}
 
-	if handler, ok := r.handlers[msg.Channel]; ok {
+	if handler, ok := handlerFor(r.handlers, msg.Channel); ok {
 		handler(&m)
 	}
 }
@@ -96,37 +110,11 @@ func (r *RedisPubSub) Publish(ctx context.Context, channel string, msg *Message)
 }
 
 func (r *RedisPubSub) PublishRoomMessage(ctx context.Context, roomID uint64, payload []byte) error {
-	msg := &Message{
-		Type:     "room_message",
-		ServerID: r.serverID,
-		RoomID:   roomID,
-		Payload:  payload,
-	}
-	return r.Publish(ctx, ChannelRoomMessage, msg)
+	return r.Publish(ctx, RoomChannel(roomID), newRoomMessage(r.serverID, roomID, payload))
 }
 
 func (r *RedisPubSub) PublishUserMessage(ctx context.Context, userID uint64, payload []byte) error {
-	msg := &Message{
-		Type:     "user_message",
-		ServerID: r.serverID,
-		UserID:   userID,
-		Payload:  payload,
-	}
-	return r.Publish(ctx, ChannelUserMessage, msg)
-}
-
-func (r *RedisPubSub) PublishPresence(ctx context.Context, userID uint64, status string) error {
-	payload, _ := json.Marshal(map[string]interface{}{
-		"user_id": userID,
-		"status":  status,
-	})
-	msg := &Message{
-		Type:     "presence",
-		ServerID: r.serverID,
-		UserID:   userID,
-		Payload:  payload,
-	}
-	return r.Publish(ctx, ChannelPresence, msg)
+	return r.Publish(ctx, UserChannel(userID), newUserMessage(r.serverID, userID, payload))
 }
 
 func (r *RedisPubSub) Close() error {
@@ -134,4 +122,4 @@ func (r *RedisPubSub) Close() error {
 		return r.pubsub.Close()
 	}
 	return nil
-}
\ No newline at end of file
+}
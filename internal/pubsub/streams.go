@@ -0,0 +1,327 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// streamKeyPrefix namespaces the stream behind each channel
+	streamKeyPrefix = "stream:"
+	// streamBlock bounds each blocking read so Close is noticed
+	streamBlock     = 5 * time.Second
+	streamReadCount = 100
+
+	streamMinBackoff = 100 * time.Millisecond
+	streamMaxBackoff = 10 * time.Second
+)
+
+// StreamStats reports the health of a RedisStreamBroker
+type StreamStats struct {
+	Connected       bool       `json:"connected"`
+	Streams         int        `json:"streams"`
+	Delivered       uint64     `json:"delivered"`
+	Reconnects      uint64     `json:"reconnects"`
+	LastReconnectAt *time.Time `json:"last_reconnect_at,omitempty"`
+	// LagMillis is how old the most recently read entry was when this server read it
+	LagMillis int64 `json:"lag_ms"`
+}
+
+// RedisStreamBroker is a Broker on Redis Streams. Each channel is a capped stream and every
+// server reads the streams it subscribes to from its own offsets, so after a dropped
+// connection it picks up where it left off instead of losing what was published meanwhile.
+// Entries are kept for up to maxLen per stream and expire after retention without traffic,
+// which bounds how long an outage can be bridged. Offsets live only in memory, so this covers
+// a dropped Redis connection, not a restart: a restarted server reads from the stream ends.
+type RedisStreamBroker struct {
+	client    *redis.Client
+	serverID  string
+	maxLen    int64
+	retention time.Duration
+
+	mu       sync.Mutex
+	handlers map[string]func(*Message)
+	offsets  map[string]string // stream key -> ID of the last entry read
+
+	// wakeKey is a stream only this server reads; writing to it interrupts a blocking read
+	// so new subscriptions take effect at once. It expires after retention in case the
+	// server dies without Close.
+	wakeKey  string
+	starting sync.Once
+	done     chan struct{}
+	closing  sync.Once
+
+	connected       atomic.Bool
+	delivered       atomic.Uint64
+	reconnects      atomic.Uint64
+	lastReconnectAt atomic.Int64
+	lagMillis       atomic.Int64
+}
+
+func NewRedisStreamBroker(client *redis.Client, maxLen int64, retention time.Duration) *RedisStreamBroker {
+	serverID := uuid.New().String()
+	return &RedisStreamBroker{
+		client:    client,
+		serverID:  serverID,
+		maxLen:    maxLen,
+		retention: retention,
+		handlers:  make(map[string]func(*Message)),
+		offsets:   make(map[string]string),
+		wakeKey:   streamKeyPrefix + "node:" + serverID,
+		done:      make(chan struct{}),
+	}
+}
+
+func streamKey(channel string) string {
+	return streamKeyPrefix + channel
+}
+
+// Subscribe starts reading the channels' streams from their current ends. The first call
+// starts the reader, which runs until ctx is done or the broker is closed.
+func (b *RedisStreamBroker) Subscribe(ctx context.Context, channels ...string) error {
+	for _, channel := range channels {
+		key := streamKey(channel)
+		offset := b.streamEnd(ctx, key)
+
+		b.mu.Lock()
+		if _, ok := b.offsets[key]; !ok {
+			b.offsets[key] = offset
+		}
+		b.mu.Unlock()
+	}
+
+	b.starting.Do(func() {
+		b.connected.Store(true)
+		go b.read(ctx)
+	})
+	b.wake(ctx)
+	return nil
+}
+
+// streamEnd returns the ID of the newest entry in the stream. When Redis can't be asked,
+// it falls back to an ID for the current time.
+func (b *RedisStreamBroker) streamEnd(ctx context.Context, key string) string {
+	entries, err := b.client.XRevRangeN(ctx, key, "+", "-", 1).Result()
+	if err != nil {
+		log.Printf("[PubSub] Failed to find the end of %s, starting from now: %v", key, err)
+		return fmt.Sprintf("%d-0", time.Now().UnixMilli())
+	}
+	if len(entries) == 0 {
+		return "0-0"
+	}
+	return entries[0].ID
+}
+
+func (b *RedisStreamBroker) Unsubscribe(ctx context.Context, channels ...string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, channel := range channels {
+		delete(b.offsets, streamKey(channel))
+	}
+	return nil
+}
+
+func (b *RedisStreamBroker) wake(ctx context.Context) {
+	_, err := b.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: b.wakeKey,
+			MaxLen: 1,
+			Values: map[string]interface{}{"wake": 1},
+		})
+		pipe.Expire(ctx, b.wakeKey, b.retention)
+		return nil
+	})
+	if err != nil {
+		log.Printf("[PubSub] Failed to wake stream reader: %v", err)
+	}
+}
+
+// read is the reader loop. Failed reads are retried with exponential backoff from the same
+// offsets, so entries published during the outage are delivered once Redis is back.
+func (b *RedisStreamBroker) read(ctx context.Context) {
+	wakeOffset := "0-0"
+	backoff := streamMinBackoff
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-b.done:
+			return
+		default:
+		}
+
+		streams := b.readArgs(wakeOffset)
+		results, err := b.client.XRead(ctx, &redis.XReadArgs{
+			Streams: streams,
+			Count:   streamReadCount,
+			Block:   streamBlock,
+		}).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			if b.connected.Swap(false) {
+				log.Printf("[PubSub] Lost Redis stream connection: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-b.done:
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, streamMaxBackoff)
+			continue
+		}
+
+		if !b.connected.Swap(true) {
+			b.reconnects.Add(1)
+			b.lastReconnectAt.Store(time.Now().UnixNano())
+			log.Printf("[PubSub] Redis stream connection restored, catching up")
+		}
+		backoff = streamMinBackoff
+
+		for _, stream := range results {
+			if stream.Stream == b.wakeKey {
+				wakeOffset = stream.Messages[len(stream.Messages)-1].ID
+				continue
+			}
+			for _, entry := range stream.Messages {
+				if !b.advance(stream.Stream, entry.ID) {
+					break
+				}
+				b.dispatch(stream.Stream, entry)
+			}
+		}
+	}
+}
+
+// readArgs lists the subscribed streams followed by their offsets, as XREAD expects
+func (b *RedisStreamBroker) readArgs(wakeOffset string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	keys := make([]string, 0, len(b.offsets)+1)
+	ids := make([]string, 0, len(b.offsets)+1)
+	for key, offset := range b.offsets {
+		keys = append(keys, key)
+		ids = append(ids, offset)
+	}
+	keys = append(keys, b.wakeKey)
+	ids = append(ids, wakeOffset)
+	return append(keys, ids...)
+}
+
+// advance moves the stream's offset to id. It reports false when the stream was
+// unsubscribed while the read was in flight.
+func (b *RedisStreamBroker) advance(key, id string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.offsets[key]; !ok {
+		return false
+	}
+	b.offsets[key] = id
+	return true
+}
+
+func (b *RedisStreamBroker) dispatch(key string, entry redis.XMessage) {
+	if ms, err := strconv.ParseInt(strings.SplitN(entry.ID, "-", 2)[0], 10, 64); err == nil {
+		b.lagMillis.Store(time.Now().UnixMilli() - ms)
+	}
+
+	data, _ := entry.Values["data"].(string)
+	var m Message
+	if err := json.Unmarshal([]byte(data), &m); err != nil {
+		log.Printf("Failed to unmarshal stream message %s: %v", entry.ID, err)
+		return
+	}
+
+	// Ignore messages from self
+	if m.ServerID == b.serverID {
+		return
+	}
+
+	b.mu.Lock()
+	handler, ok := handlerFor(b.handlers, strings.TrimPrefix(key, streamKeyPrefix))
+	b.mu.Unlock()
+	if ok {
+		b.delivered.Add(1)
+		handler(&m)
+	}
+}
+
+func (b *RedisStreamBroker) OnMessage(channel string, handler func(*Message)) {
+	b.mu.Lock()
+	b.handlers[channel] = handler
+	b.mu.Unlock()
+}
+
+// Publish appends msg to the channel's stream, trimming it to maxLen and renewing its expiry
+func (b *RedisStreamBroker) Publish(ctx context.Context, channel string, msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	key := streamKey(channel)
+	_, err = b.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: key,
+			MaxLen: b.maxLen,
+			Approx: true,
+			Values: map[string]interface{}{"data": data},
+		})
+		pipe.Expire(ctx, key, b.retention)
+		return nil
+	})
+	return err
+}
+
+func (b *RedisStreamBroker) PublishRoomMessage(ctx context.Context, roomID uint64, payload []byte) error {
+	return b.Publish(ctx, RoomChannel(roomID), newRoomMessage(b.serverID, roomID, payload))
+}
+
+func (b *RedisStreamBroker) PublishUserMessage(ctx context.Context, userID uint64, payload []byte) error {
+	return b.Publish(ctx, UserChannel(userID), newUserMessage(b.serverID, userID, payload))
+}
+
+// Stats reports the connection state, delivery lag and reconnects of the reader
+func (b *RedisStreamBroker) Stats() StreamStats {
+	b.mu.Lock()
+	streams := len(b.offsets)
+	b.mu.Unlock()
+
+	stats := StreamStats{
+		Connected:  b.connected.Load(),
+		Streams:    streams,
+		Delivered:  b.delivered.Load(),
+		Reconnects: b.reconnects.Load(),
+		LagMillis:  b.lagMillis.Load(),
+	}
+	if ns := b.lastReconnectAt.Load(); ns != 0 {
+		at := time.Unix(0, ns)
+		stats.LastReconnectAt = &at
+	}
+	return stats
+}
+
+// Close stops the reader and removes this server's wake stream
+func (b *RedisStreamBroker) Close() error {
+	var err error
+	b.closing.Do(func() {
+		close(b.done)
+		err = b.client.Del(context.Background(), b.wakeKey).Err()
+	})
+	return err
+}
@@ -0,0 +1,161 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestStreamBroker returns a broker that is never connected; only its offset
+// bookkeeping is exercised
+func newTestStreamBroker(offsets map[string]string) *RedisStreamBroker {
+	b := NewRedisStreamBroker(nil, 1000, time.Hour)
+	for key, offset := range offsets {
+		b.offsets[key] = offset
+	}
+	return b
+}
+
+func TestStreamReadArgs(t *testing.T) {
+	tests := []struct {
+		name       string
+		offsets    map[string]string
+		wakeOffset string
+	}{
+		{"no subscriptions", nil, "0-0"},
+		{"one stream", map[string]string{"stream:room:1": "5-0"}, "0-0"},
+		{"several streams", map[string]string{"stream:room:1": "5-0", "stream:user:2": "7-1"}, "9-0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestStreamBroker(tt.offsets)
+			args := b.readArgs(tt.wakeOffset)
+
+			if len(args)%2 != 0 {
+				t.Fatalf("readArgs returned an odd number of arguments: %v", args)
+			}
+			n := len(args) / 2
+			if n != len(tt.offsets)+1 {
+				t.Fatalf("readArgs returned %d streams, want %d", n, len(tt.offsets)+1)
+			}
+
+			// Each key must line up with its own offset, with the wake stream last
+			got := make(map[string]string, n)
+			for i := 0; i < n; i++ {
+				got[args[i]] = args[n+i]
+			}
+			if args[n-1] != b.wakeKey || args[2*n-1] != tt.wakeOffset {
+				t.Errorf("wake stream = %s %s, want %s %s", args[n-1], args[2*n-1], b.wakeKey, tt.wakeOffset)
+			}
+			delete(got, b.wakeKey)
+			if len(got) != len(tt.offsets) {
+				t.Fatalf("offsets = %v, want %v", got, tt.offsets)
+			}
+			for key, offset := range tt.offsets {
+				if got[key] != offset {
+					t.Errorf("offset of %s = %s, want %s", key, got[key], offset)
+				}
+			}
+		})
+	}
+}
+
+func TestStreamAdvance(t *testing.T) {
+	tests := []struct {
+		name    string
+		offsets map[string]string
+		key     string
+		id      string
+		wantOK  bool
+		want    map[string]string
+	}{
+		{
+			name:    "subscribed stream moves forward",
+			offsets: map[string]string{"stream:room:1": "5-0"},
+			key:     "stream:room:1",
+			id:      "6-0",
+			wantOK:  true,
+			want:    map[string]string{"stream:room:1": "6-0"},
+		},
+		{
+			name:    "other streams are untouched",
+			offsets: map[string]string{"stream:room:1": "5-0", "stream:room:2": "3-0"},
+			key:     "stream:room:2",
+			id:      "4-0",
+			wantOK:  true,
+			want:    map[string]string{"stream:room:1": "5-0", "stream:room:2": "4-0"},
+		},
+		{
+			name:    "unsubscribed stream is not resurrected",
+			offsets: map[string]string{"stream:room:1": "5-0"},
+			key:     "stream:room:9",
+			id:      "6-0",
+			wantOK:  false,
+			want:    map[string]string{"stream:room:1": "5-0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestStreamBroker(tt.offsets)
+			if ok := b.advance(tt.key, tt.id); ok != tt.wantOK {
+				t.Errorf("advance(%s, %s) = %v, want %v", tt.key, tt.id, ok, tt.wantOK)
+			}
+			if !reflect.DeepEqual(b.offsets, tt.want) {
+				t.Errorf("offsets = %v, want %v", b.offsets, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamUnsubscribeStopsAdvance(t *testing.T) {
+	b := newTestStreamBroker(map[string]string{"stream:room:1": "5-0", "stream:room:2": "3-0"})
+
+	if err := b.Unsubscribe(context.Background(), "room:1"); err != nil {
+		t.Fatal(err)
+	}
+	if b.advance("stream:room:1", "6-0") {
+		t.Error("advance succeeded on an unsubscribed stream")
+	}
+
+	var keys []string
+	for key := range b.offsets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if !reflect.DeepEqual(keys, []string{"stream:room:2"}) {
+		t.Errorf("subscribed streams = %v, want [stream:room:2]", keys)
+	}
+	if got := b.Stats().Streams; got != 1 {
+		t.Errorf("Stats().Streams = %d, want 1", got)
+	}
+}
+
+func TestStreamDispatch(t *testing.T) {
+	b := newTestStreamBroker(map[string]string{"stream:room:1": "0-0"})
+
+	var got []*Message
+	b.OnMessage(ChannelRoomPrefix, func(m *Message) { got = append(got, m) })
+
+	entry := func(id string, m *Message) redis.XMessage {
+		data, _ := json.Marshal(m)
+		return redis.XMessage{ID: id, Values: map[string]interface{}{"data": string(data)}}
+	}
+
+	b.dispatch("stream:room:1", entry("1-0", newRoomMessage("other-server", 1, []byte(`{}`))))
+	b.dispatch("stream:room:1", entry("2-0", newRoomMessage(b.serverID, 1, []byte(`{}`))))
+	b.dispatch("stream:room:1", redis.XMessage{ID: "3-0", Values: map[string]interface{}{"data": "not json"}})
+
+	if len(got) != 1 || got[0].ServerID != "other-server" || got[0].RoomID != 1 {
+		t.Fatalf("delivered %+v, want only the message from other-server", got)
+	}
+	if delivered := b.Stats().Delivered; delivered != 1 {
+		t.Errorf("Stats().Delivered = %d, want 1", delivered)
+	}
+}
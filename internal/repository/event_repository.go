@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"Mmessenger/internal/models"
+)
+
+type EventRepository struct {
+	db *sql.DB
+}
+
+func NewEventRepository(db *sql.DB) *EventRepository {
+	return &EventRepository{db: db}
+}
+
+func (r *EventRepository) Create(ctx context.Context, event *models.Event) error {
+	query := `
+		INSERT INTO events (room_id, user_id, event_type, payload)
+		VALUES (?, ?, ?, ?)
+	`
+	result, err := r.db.ExecContext(ctx, query, event.RoomID, event.UserID, event.EventType, []byte(event.Payload))
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	event.ID = uint64(id)
+	event.CreatedAt = time.Now()
+	return nil
+}
+
+// GetForUser returns events after afterID addressed to the user directly or to any room they
+// are in. Room events from before the user joined that room are left out.
+func (r *EventRepository) GetForUser(ctx context.Context, userID, afterID uint64, limit int) ([]*models.Event, error) {
+	query := `
+		SELECT e.id, e.room_id, e.user_id, e.event_type, e.payload, e.created_at
+		FROM events e
+		LEFT JOIN room_members rm ON rm.room_id = e.room_id AND rm.user_id = ?
+		WHERE e.id > ?
+		AND (e.user_id = ? OR e.created_at >= rm.joined_at)
+		ORDER BY e.id ASC
+		LIMIT ?
+	`
+	rows, err := r.db.QueryContext(ctx, query, userID, afterID, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*models.Event
+	for rows.Next() {
+		event := &models.Event{}
+		var payload []byte
+		if err := rows.Scan(&event.ID, &event.RoomID, &event.UserID, &event.EventType, &payload, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		event.Payload = payload
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// GetIDRange returns the oldest and newest retained event IDs, or zeros when the log is empty
+func (r *EventRepository) GetIDRange(ctx context.Context) (oldest, latest uint64, err error) {
+	query := `SELECT COALESCE(MIN(id), 0), COALESCE(MAX(id), 0) FROM events`
+	err = r.db.QueryRowContext(ctx, query).Scan(&oldest, &latest)
+	return oldest, latest, err
+}
+
+// DeleteBefore prunes events created before the given time
+func (r *EventRepository) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM events WHERE created_at < ?`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"Mmessenger/internal/models"
+)
+
+type MentionRepository struct {
+	db *sql.DB
+}
+
+func NewMentionRepository(db *sql.DB) *MentionRepository {
+	return &MentionRepository{db: db}
+}
+
+// CreateBatch stores the mentions of one message
+func (r *MentionRepository) CreateBatch(ctx context.Context, mentions []*models.MessageMention) error {
+	if len(mentions) == 0 {
+		return nil
+	}
+
+	values := make([]string, len(mentions))
+	args := make([]interface{}, 0, len(mentions)*4)
+	for i, m := range mentions {
+		values[i] = "(?, ?, ?, ?)"
+		args = append(args, m.MessageID, m.RoomID, m.UserID, m.MentionType)
+	}
+
+	query := `
+		INSERT IGNORE INTO message_mentions (message_id, room_id, user_id, mention_type)
+		VALUES ` + strings.Join(values, ", ")
+	_, err := r.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+// GetByMessageIDs returns the mentions as written in each message: one entry per mentioned
+// user for @username, and a single entry (UserID 0) for @here and @all
+func (r *MentionRepository) GetByMessageIDs(ctx context.Context, messageIDs []uint64) (map[uint64][]*models.MessageMention, error) {
+	mentions := make(map[uint64][]*models.MessageMention)
+	if len(messageIDs) == 0 {
+		return mentions, nil
+	}
+
+	query := `
+		SELECT DISTINCT message_id, mention_type, IF(mention_type = 'user', user_id, 0)
+		FROM message_mentions
+		WHERE message_id IN (?` + repeatPlaceholder(len(messageIDs)-1) + `)
+		ORDER BY message_id, mention_type, 3
+	`
+	args := make([]interface{}, len(messageIDs))
+	for i, id := range messageIDs {
+		args[i] = id
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m := &models.MessageMention{}
+		if err := rows.Scan(&m.MessageID, &m.MentionType, &m.UserID); err != nil {
+			return nil, err
+		}
+		mentions[m.MessageID] = append(mentions[m.MessageID], m)
+	}
+	return mentions, nil
+}
+
+// GetForUser returns mentions of the user, newest first, from live messages in rooms the
+// user still belongs to. beforeID is a mention ID cursor; 0 starts from the newest.
+func (r *MentionRepository) GetForUser(ctx context.Context, userID, beforeID uint64, limit int) ([]*models.MessageMention, error) {
+	query := `
+		SELECT mm.id, mm.message_id, mm.room_id, mm.user_id, mm.mention_type, mm.created_at
+		FROM message_mentions mm
+		INNER JOIN messages m ON m.id = mm.message_id AND m.is_deleted = FALSE
+		INNER JOIN room_members rm ON rm.room_id = mm.room_id AND rm.user_id = mm.user_id
+		WHERE mm.user_id = ? AND (? = 0 OR mm.id < ?)
+		ORDER BY mm.id DESC
+		LIMIT ?
+	`
+	rows, err := r.db.QueryContext(ctx, query, userID, beforeID, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mentions []*models.MessageMention
+	for rows.Next() {
+		m := &models.MessageMention{}
+		if err := rows.Scan(&m.ID, &m.MessageID, &m.RoomID, &m.UserID, &m.MentionType, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		mentions = append(mentions, m)
+	}
+	return mentions, nil
+}
@@ -3,10 +3,38 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 
 	"Mmessenger/internal/models"
+
+	"github.com/go-sql-driver/mysql"
 )
 
+// ErrDuplicateClientMessageID is returned by Create when the sender already stored a message
+// with the same client message ID
+var ErrDuplicateClientMessageID = errors.New("duplicate client message id")
+
+// messageColumns is the column list scanned by scanMessage
+const messageColumns = `id, room_id, sender_id, client_message_id, parent_id, content, message_type, file_url, thumbnail_url, metadata,
+		thread_reply_count, is_edited, is_deleted, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanMessage(row rowScanner) (*models.Message, error) {
+	msg := &models.Message{}
+	err := row.Scan(
+		&msg.ID, &msg.RoomID, &msg.SenderID, &msg.ClientMessageID, &msg.ParentID, &msg.Content, &msg.MessageType,
+		&msg.FileURL, &msg.ThumbnailURL, &msg.Metadata, &msg.ThreadReplyCount, &msg.IsEdited, &msg.IsDeleted,
+		&msg.CreatedAt, &msg.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
 type MessageRepository struct {
 	db *sql.DB
 }
@@ -15,15 +43,28 @@ func NewMessageRepository(db *sql.DB) *MessageRepository {
 	return &MessageRepository{db: db}
 }
 
+// Create inserts the message. A reply also bumps its parent's thread_reply_count in the
+// same transaction.
 func (r *MessageRepository) Create(ctx context.Context, msg *models.Message) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
-		INSERT INTO messages (room_id, sender_id, content, message_type, file_url, thumbnail_url)
-		VALUES (?, ?, ?, ?, ?, ?)
+		INSERT INTO messages (room_id, sender_id, client_message_id, parent_id, content, message_type, file_url, thumbnail_url, metadata)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	result, err := r.db.ExecContext(ctx, query,
-		msg.RoomID, msg.SenderID, msg.Content, msg.MessageType, msg.FileURL, msg.ThumbnailURL,
+	result, err := tx.ExecContext(ctx, query,
+		msg.RoomID, msg.SenderID, msg.ClientMessageID, msg.ParentID, msg.Content, msg.MessageType, msg.FileURL, msg.ThumbnailURL,
+		msg.Metadata,
 	)
 	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+			return ErrDuplicateClientMessageID
+		}
 		return err
 	}
 
@@ -31,39 +72,84 @@ func (r *MessageRepository) Create(ctx context.Context, msg *models.Message) err
 	if err != nil {
 		return err
 	}
+
+	if msg.ParentID.Valid {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE messages SET thread_reply_count = thread_reply_count + 1 WHERE id = ?`, msg.ParentID.Int64,
+		); err != nil {
+			return err
+		}
+	}
+
 	msg.ID = uint64(id)
 
 	// Fetch created_at from database
-	err = r.db.QueryRowContext(ctx, "SELECT created_at FROM messages WHERE id = ?", msg.ID).Scan(&msg.CreatedAt)
-	return err
+	if err := tx.QueryRowContext(ctx, "SELECT created_at FROM messages WHERE id = ?", msg.ID).Scan(&msg.CreatedAt); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func (r *MessageRepository) GetByID(ctx context.Context, id uint64) (*models.Message, error) {
 	query := `
-		SELECT id, room_id, sender_id, content, message_type, file_url, thumbnail_url, is_edited, is_deleted, created_at, updated_at
+		SELECT ` + messageColumns + `
 		FROM messages WHERE id = ?
 	`
-	msg := &models.Message{}
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&msg.ID, &msg.RoomID, &msg.SenderID, &msg.Content, &msg.MessageType,
-		&msg.FileURL, &msg.ThumbnailURL, &msg.IsEdited, &msg.IsDeleted,
-		&msg.CreatedAt, &msg.UpdatedAt,
-	)
+	return scanMessage(r.db.QueryRowContext(ctx, query, id))
+}
+
+// GetByIDs returns the messages with the given IDs, keyed by ID
+func (r *MessageRepository) GetByIDs(ctx context.Context, ids []uint64) (map[uint64]*models.Message, error) {
+	messages := make(map[uint64]*models.Message, len(ids))
+	if len(ids) == 0 {
+		return messages, nil
+	}
+
+	query := `
+		SELECT ` + messageColumns + `
+		FROM messages WHERE id IN (?` + repeatPlaceholder(len(ids)-1) + `)
+	`
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
-	return msg, nil
+	defer rows.Close()
+
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages[msg.ID] = msg
+	}
+	return messages, nil
 }
 
-func (r *MessageRepository) GetByRoomID(ctx context.Context, roomID uint64, limit, offset int) ([]*models.Message, error) {
+// GetByClientMessageID returns the message a sender stored under the given client message ID
+func (r *MessageRepository) GetByClientMessageID(ctx context.Context, senderID uint64, clientMessageID string) (*models.Message, error) {
 	query := `
-		SELECT id, room_id, sender_id, content, message_type, file_url, thumbnail_url, is_edited, is_deleted, created_at, updated_at
+		SELECT ` + messageColumns + `
+		FROM messages WHERE sender_id = ? AND client_message_id = ?
+	`
+	return scanMessage(r.db.QueryRowContext(ctx, query, senderID, clientMessageID))
+}
+
+// GetByRoomIDBefore returns up to limit messages older than beforeID in chronological order.
+// A zero beforeID starts from the newest message.
+func (r *MessageRepository) GetByRoomIDBefore(ctx context.Context, roomID uint64, beforeID uint64, limit int) ([]*models.Message, error) {
+	query := `
+		SELECT ` + messageColumns + `
 		FROM messages
-		WHERE room_id = ? AND is_deleted = FALSE
-		ORDER BY created_at DESC
-		LIMIT ? OFFSET ?
+		WHERE room_id = ? AND (? = 0 OR id < ?) AND is_deleted = FALSE
+		ORDER BY id DESC
+		LIMIT ?
 	`
-	rows, err := r.db.QueryContext(ctx, query, roomID, limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, roomID, beforeID, beforeID, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -71,12 +157,7 @@ func (r *MessageRepository) GetByRoomID(ctx context.Context, roomID uint64, limi
 
 	var messages []*models.Message
 	for rows.Next() {
-		msg := &models.Message{}
-		err := rows.Scan(
-			&msg.ID, &msg.RoomID, &msg.SenderID, &msg.Content, &msg.MessageType,
-			&msg.FileURL, &msg.ThumbnailURL, &msg.IsEdited, &msg.IsDeleted,
-			&msg.CreatedAt, &msg.UpdatedAt,
-		)
+		msg, err := scanMessage(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -93,7 +174,7 @@ func (r *MessageRepository) GetByRoomID(ctx context.Context, roomID uint64, limi
 // GetByRoomIDAfter returns messages after the given message ID (for fetching missed messages)
 func (r *MessageRepository) GetByRoomIDAfter(ctx context.Context, roomID uint64, afterID uint64, limit int) ([]*models.Message, error) {
 	query := `
-		SELECT id, room_id, sender_id, content, message_type, file_url, thumbnail_url, is_edited, is_deleted, created_at, updated_at
+		SELECT ` + messageColumns + `
 		FROM messages
 		WHERE room_id = ? AND id > ? AND is_deleted = FALSE
 		ORDER BY id ASC
@@ -107,12 +188,99 @@ func (r *MessageRepository) GetByRoomIDAfter(ctx context.Context, roomID uint64,
 
 	var messages []*models.Message
 	for rows.Next() {
-		msg := &models.Message{}
-		err := rows.Scan(
-			&msg.ID, &msg.RoomID, &msg.SenderID, &msg.Content, &msg.MessageType,
-			&msg.FileURL, &msg.ThumbnailURL, &msg.IsEdited, &msg.IsDeleted,
-			&msg.CreatedAt, &msg.UpdatedAt,
-		)
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, nil
+}
+
+// GetThreadReplies returns replies to a parent message in chronological order, starting after afterID
+func (r *MessageRepository) GetThreadReplies(ctx context.Context, parentID, afterID uint64, limit int) ([]*models.Message, error) {
+	query := `
+		SELECT ` + messageColumns + `
+		FROM messages
+		WHERE parent_id = ? AND id > ? AND is_deleted = FALSE
+		ORDER BY id ASC
+		LIMIT ?
+	`
+	rows, err := r.db.QueryContext(ctx, query, parentID, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*models.Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, nil
+}
+
+// Search runs a FULLTEXT query over messages in the given rooms, newest first.
+// booleanQuery must already be in MySQL BOOLEAN MODE syntax.
+func (r *MessageRepository) Search(ctx context.Context, roomIDs []uint64, booleanQuery string, filter *models.MessageSearchFilter) ([]*models.Message, error) {
+	if len(roomIDs) == 0 {
+		return nil, nil
+	}
+
+	query := `
+		SELECT ` + messageColumns + `
+		FROM messages
+		WHERE MATCH(content) AGAINST(? IN BOOLEAN MODE)
+		AND is_deleted = FALSE
+		AND room_id IN (?` + repeatPlaceholder(len(roomIDs)-1) + `)`
+
+	args := make([]interface{}, 0, len(roomIDs)+6)
+	args = append(args, booleanQuery)
+	for _, id := range roomIDs {
+		args = append(args, id)
+	}
+
+	if filter.SenderID != 0 {
+		query += ` AND sender_id = ?`
+		args = append(args, filter.SenderID)
+	}
+	if filter.MessageType != "" {
+		query += ` AND message_type = ?`
+		args = append(args, filter.MessageType)
+	}
+	if filter.From != nil {
+		query += ` AND created_at >= ?`
+		args = append(args, *filter.From)
+	}
+	if filter.To != nil {
+		query += ` AND created_at < ?`
+		args = append(args, *filter.To)
+	}
+	if filter.BeforeID != 0 {
+		query += ` AND id < ?`
+		args = append(args, filter.BeforeID)
+	}
+
+	query += `
+		ORDER BY id DESC
+		LIMIT ?
+	`
+	args = append(args, filter.Limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*models.Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -122,31 +290,119 @@ func (r *MessageRepository) GetByRoomIDAfter(ctx context.Context, roomID uint64,
 	return messages, nil
 }
 
-func (r *MessageRepository) Update(ctx context.Context, msg *models.Message) error {
+// Update replaces the content of a message, saving the previous content as a revision
+// attributed to editorID in the same transaction, and reads back the stored edit time
+// into msg.UpdatedAt.
+func (r *MessageRepository) Update(ctx context.Context, msg *models.Message, editorID uint64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	revisionQuery := `
+		INSERT INTO message_revisions (message_id, editor_id, content)
+		SELECT id, ?, content FROM messages WHERE id = ?
+	`
+	if _, err := tx.ExecContext(ctx, revisionQuery, editorID, msg.ID); err != nil {
+		return err
+	}
+
 	query := `
 		UPDATE messages SET content = ?, is_edited = TRUE, updated_at = NOW()
 		WHERE id = ?
 	`
-	_, err := r.db.ExecContext(ctx, query, msg.Content, msg.ID)
-	return err
+	if _, err := tx.ExecContext(ctx, query, msg.Content, msg.ID); err != nil {
+		return err
+	}
+
+	if err := tx.QueryRowContext(ctx, `SELECT updated_at FROM messages WHERE id = ?`, msg.ID).Scan(&msg.UpdatedAt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (r *MessageRepository) Delete(ctx context.Context, id uint64) error {
-	query := `UPDATE messages SET is_deleted = TRUE, updated_at = NOW() WHERE id = ?`
-	_, err := r.db.ExecContext(ctx, query, id)
-	return err
+// GetRevisions returns the previous versions of a message, oldest first
+func (r *MessageRepository) GetRevisions(ctx context.Context, messageID uint64) ([]*models.MessageRevision, error) {
+	query := `
+		SELECT id, message_id, editor_id, content, created_at
+		FROM message_revisions
+		WHERE message_id = ?
+		ORDER BY id ASC
+	`
+	rows, err := r.db.QueryContext(ctx, query, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []*models.MessageRevision
+	for rows.Next() {
+		rev := &models.MessageRevision{}
+		if err := rows.Scan(&rev.ID, &rev.MessageID, &rev.EditorID, &rev.Content, &rev.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, nil
+}
+
+// Delete soft-deletes the message and removes its pin, reporting whether it was pinned.
+// Deleting a reply takes it off its parent's thread_reply_count.
+func (r *MessageRepository) Delete(ctx context.Context, id uint64) (unpinned bool, err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx,
+		`UPDATE messages SET is_deleted = TRUE, updated_at = NOW() WHERE id = ? AND is_deleted = FALSE`, id,
+	)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	// Only the delete that actually flipped is_deleted may decrement the count
+	if deleted > 0 {
+		threadQuery := `
+			UPDATE messages p
+			JOIN messages m ON m.parent_id = p.id
+			SET p.thread_reply_count = p.thread_reply_count - 1
+			WHERE m.id = ? AND p.thread_reply_count > 0
+		`
+		if _, err := tx.ExecContext(ctx, threadQuery, id); err != nil {
+			return false, err
+		}
+	}
+
+	result, err = tx.ExecContext(ctx, `DELETE FROM room_pins WHERE message_id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, tx.Commit()
 }
 
 // GetUnreadCount returns the number of room members who haven't read the message yet
-func (r *MessageRepository) GetUnreadCount(ctx context.Context, roomID uint64, messageCreatedAt interface{}, senderID uint64) (int, error) {
+func (r *MessageRepository) GetUnreadCount(ctx context.Context, roomID, messageID, senderID uint64) (int, error) {
 	query := `
 		SELECT COUNT(*) FROM room_members
 		WHERE room_id = ?
 		AND user_id != ?
-		AND (last_read_at IS NULL OR last_read_at < ?)
+		AND (last_read_message_id IS NULL OR last_read_message_id < ?)
 	`
 	var count int
-	err := r.db.QueryRowContext(ctx, query, roomID, senderID, messageCreatedAt).Scan(&count)
+	err := r.db.QueryRowContext(ctx, query, roomID, senderID, messageID).Scan(&count)
 	return count, err
 }
 
@@ -159,7 +415,7 @@ func (r *MessageRepository) GetUnreadCountForUser(ctx context.Context, roomID ui
 		WHERE m.room_id = ?
 		AND m.is_deleted = FALSE
 		AND m.sender_id != ?
-		AND (rm.last_read_at IS NULL OR m.created_at > rm.last_read_at)
+		AND m.id > COALESCE(rm.last_read_message_id, 0)
 	`
 	var count int
 	err := r.db.QueryRowContext(ctx, query, userID, roomID, userID).Scan(&count)
@@ -174,7 +430,7 @@ func (r *MessageRepository) GetUnreadCountsForUser(ctx context.Context, userID u
 		LEFT JOIN messages m ON m.room_id = rm.room_id
 			AND m.is_deleted = FALSE
 			AND m.sender_id != ?
-			AND (rm.last_read_at IS NULL OR m.created_at > rm.last_read_at)
+			AND m.id > COALESCE(rm.last_read_message_id, 0)
 		WHERE rm.user_id = ?
 		GROUP BY rm.room_id
 	`
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"Mmessenger/internal/models"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// ErrDuplicatePin is returned by Create when the message is already pinned
+var ErrDuplicatePin = errors.New("message is already pinned")
+
+type PinRepository struct {
+	db *sql.DB
+}
+
+func NewPinRepository(db *sql.DB) *PinRepository {
+	return &PinRepository{db: db}
+}
+
+func (r *PinRepository) Create(ctx context.Context, pin *models.RoomPin) error {
+	query := `
+		INSERT INTO room_pins (room_id, message_id, pinned_by)
+		VALUES (?, ?, ?)
+	`
+	result, err := r.db.ExecContext(ctx, query, pin.RoomID, pin.MessageID, pin.PinnedBy)
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+			return ErrDuplicatePin
+		}
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	pin.ID = uint64(id)
+	pin.PinnedAt = time.Now()
+	return nil
+}
+
+// Delete unpins the message, reporting whether it was pinned in the room
+func (r *PinRepository) Delete(ctx context.Context, roomID, messageID uint64) (bool, error) {
+	query := `DELETE FROM room_pins WHERE room_id = ? AND message_id = ?`
+	result, err := r.db.ExecContext(ctx, query, roomID, messageID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// GetByRoomID returns the room's pins, most recently pinned first
+func (r *PinRepository) GetByRoomID(ctx context.Context, roomID uint64) ([]*models.RoomPin, error) {
+	query := `
+		SELECT id, room_id, message_id, pinned_by, pinned_at
+		FROM room_pins WHERE room_id = ?
+		ORDER BY pinned_at DESC, id DESC
+	`
+	rows, err := r.db.QueryContext(ctx, query, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pins []*models.RoomPin
+	for rows.Next() {
+		pin := &models.RoomPin{}
+		if err := rows.Scan(&pin.ID, &pin.RoomID, &pin.MessageID, &pin.PinnedBy, &pin.PinnedAt); err != nil {
+			return nil, err
+		}
+		pins = append(pins, pin)
+	}
+	return pins, nil
+}
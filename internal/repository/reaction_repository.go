@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"Mmessenger/internal/models"
+)
+
+type ReactionRepository struct {
+	db *sql.DB
+}
+
+func NewReactionRepository(db *sql.DB) *ReactionRepository {
+	return &ReactionRepository{db: db}
+}
+
+// Add stores a reaction. It reports false when the user had already reacted with the
+// same emoji, in which case nothing changes.
+func (r *ReactionRepository) Add(ctx context.Context, reaction *models.MessageReaction) (bool, error) {
+	query := `
+		INSERT IGNORE INTO message_reactions (message_id, user_id, emoji)
+		VALUES (?, ?, ?)
+	`
+	result, err := r.db.ExecContext(ctx, query, reaction.MessageID, reaction.UserID, reaction.Emoji)
+	if err != nil {
+		return false, err
+	}
+
+	added, err := result.RowsAffected()
+	if err != nil || added == 0 {
+		return false, err
+	}
+
+	id, err := result.LastInsertId()
+	if err == nil && id > 0 {
+		reaction.ID = uint64(id)
+	}
+	return true, nil
+}
+
+// Remove deletes a reaction, reporting false when there was none
+func (r *ReactionRepository) Remove(ctx context.Context, messageID, userID uint64, emoji string) (bool, error) {
+	query := `DELETE FROM message_reactions WHERE message_id = ? AND user_id = ? AND emoji = ?`
+	result, err := r.db.ExecContext(ctx, query, messageID, userID, emoji)
+	if err != nil {
+		return false, err
+	}
+
+	removed, err := result.RowsAffected()
+	return removed > 0, err
+}
+
+// GetSummaries returns aggregated reactions per message, in order of first use
+func (r *ReactionRepository) GetSummaries(ctx context.Context, messageIDs []uint64, viewerID uint64) (map[uint64][]*models.ReactionSummary, error) {
+	summaries := make(map[uint64][]*models.ReactionSummary)
+	if len(messageIDs) == 0 {
+		return summaries, nil
+	}
+
+	query := `
+		SELECT message_id, emoji, COUNT(*), MAX(user_id = ?)
+		FROM message_reactions
+		WHERE message_id IN (?` + repeatPlaceholder(len(messageIDs)-1) + `)
+		GROUP BY message_id, emoji
+		ORDER BY message_id, MIN(id)
+	`
+
+	args := make([]interface{}, 0, len(messageIDs)+1)
+	args = append(args, viewerID)
+	for _, id := range messageIDs {
+		args = append(args, id)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID uint64
+		summary := &models.ReactionSummary{}
+		if err := rows.Scan(&messageID, &summary.Emoji, &summary.Count, &summary.ReactedByMe); err != nil {
+			return nil, err
+		}
+		summaries[messageID] = append(summaries[messageID], summary)
+	}
+	return summaries, nil
+}
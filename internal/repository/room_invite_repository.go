@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"Mmessenger/internal/models"
+)
+
+// ErrInviteUnavailable is returned by Redeem when the invite was revoked, expired or used up
+var ErrInviteUnavailable = errors.New("invite is no longer usable")
+
+const roomInviteColumns = `id, room_id, token, created_by, role, max_uses, use_count, expires_at, revoked_at, created_at`
+
+func scanRoomInvite(row rowScanner) (*models.RoomInvite, error) {
+	invite := &models.RoomInvite{}
+	err := row.Scan(
+		&invite.ID, &invite.RoomID, &invite.Token, &invite.CreatedBy, &invite.Role,
+		&invite.MaxUses, &invite.UseCount, &invite.ExpiresAt, &invite.RevokedAt, &invite.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return invite, nil
+}
+
+type RoomInviteRepository struct {
+	db *sql.DB
+}
+
+func NewRoomInviteRepository(db *sql.DB) *RoomInviteRepository {
+	return &RoomInviteRepository{db: db}
+}
+
+func (r *RoomInviteRepository) Create(ctx context.Context, invite *models.RoomInvite) error {
+	query := `
+		INSERT INTO room_invites (room_id, token, created_by, role, max_uses, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+	result, err := r.db.ExecContext(ctx, query,
+		invite.RoomID, invite.Token, invite.CreatedBy, invite.Role, invite.MaxUses, invite.ExpiresAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	invite.ID = uint64(id)
+	return nil
+}
+
+func (r *RoomInviteRepository) GetByID(ctx context.Context, id uint64) (*models.RoomInvite, error) {
+	query := `SELECT ` + roomInviteColumns + ` FROM room_invites WHERE id = ?`
+	return scanRoomInvite(r.db.QueryRowContext(ctx, query, id))
+}
+
+func (r *RoomInviteRepository) GetByToken(ctx context.Context, token string) (*models.RoomInvite, error) {
+	query := `SELECT ` + roomInviteColumns + ` FROM room_invites WHERE token = ?`
+	return scanRoomInvite(r.db.QueryRowContext(ctx, query, token))
+}
+
+// GetByRoomID returns the room's invites that have not been revoked, newest first
+func (r *RoomInviteRepository) GetByRoomID(ctx context.Context, roomID uint64) ([]*models.RoomInvite, error) {
+	query := `
+		SELECT ` + roomInviteColumns + `
+		FROM room_invites
+		WHERE room_id = ? AND revoked_at IS NULL
+		ORDER BY id DESC
+	`
+	rows, err := r.db.QueryContext(ctx, query, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invites []*models.RoomInvite
+	for rows.Next() {
+		invite, err := scanRoomInvite(rows)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, invite)
+	}
+	return invites, nil
+}
+
+// Revoke disables the invite; it is kept so existing members stay attributed to it
+func (r *RoomInviteRepository) Revoke(ctx context.Context, id uint64) error {
+	query := `UPDATE room_invites SET revoked_at = NOW() WHERE id = ? AND revoked_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// Redeem uses up one use of the invite and adds the user to its room with the invite's role,
+// in one transaction, so concurrent accepts can't exceed max_uses or the room's max_members
+func (r *RoomInviteRepository) Redeem(ctx context.Context, invite *models.RoomInvite, userID uint64) (*models.RoomMember, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE room_invites SET use_count = use_count + 1
+		WHERE id = ? AND revoked_at IS NULL
+		AND (expires_at IS NULL OR expires_at > NOW())
+		AND (max_uses IS NULL OR use_count < max_uses)
+	`, invite.ID)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, ErrInviteUnavailable
+	}
+
+	member := &models.RoomMember{
+		RoomID:   invite.RoomID,
+		UserID:   userID,
+		Role:     invite.Role,
+		InviteID: sql.NullInt64{Int64: int64(invite.ID), Valid: true},
+	}
+	if err := addMember(ctx, tx, member); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return member, nil
+}
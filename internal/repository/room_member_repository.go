@@ -3,10 +3,37 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 
 	"Mmessenger/internal/models"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+var (
+	// ErrRoomFull is returned when adding a member would exceed the room's max_members
+	ErrRoomFull = errors.New("room has reached its member limit")
+	// ErrDuplicateMember is returned when the user is already in the room
+	ErrDuplicateMember = errors.New("user is already a member of this room")
 )
 
+// memberColumns is the column list scanned by scanMember
+const memberColumns = `id, room_id, user_id, role, invite_id, joined_at, last_read_at, last_read_message_id,
+		muted_until, archived, notification_level`
+
+func scanMember(row rowScanner) (*models.RoomMember, error) {
+	member := &models.RoomMember{}
+	err := row.Scan(
+		&member.ID, &member.RoomID, &member.UserID, &member.Role, &member.InviteID,
+		&member.JoinedAt, &member.LastReadAt, &member.LastReadMessageID,
+		&member.MutedUntil, &member.Archived, &member.NotificationLevel,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
 type RoomMemberRepository struct {
 	db *sql.DB
 }
@@ -15,13 +42,50 @@ func NewRoomMemberRepository(db *sql.DB) *RoomMemberRepository {
 	return &RoomMemberRepository{db: db}
 }
 
+// Add inserts the member unless the room is already at max_members
 func (r *RoomMemberRepository) Add(ctx context.Context, member *models.RoomMember) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := addMember(ctx, tx, member); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// addMember inserts a member within tx after checking the room's capacity. The room row is
+// locked first so concurrent joins can't push the room past max_members.
+func addMember(ctx context.Context, tx *sql.Tx, member *models.RoomMember) error {
+	var maxMembers int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT max_members FROM rooms WHERE id = ? FOR UPDATE`, member.RoomID,
+	).Scan(&maxMembers); err != nil {
+		return err
+	}
+
+	var count int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM room_members WHERE room_id = ?`, member.RoomID,
+	).Scan(&count); err != nil {
+		return err
+	}
+	if count >= maxMembers {
+		return ErrRoomFull
+	}
+
 	query := `
-		INSERT INTO room_members (room_id, user_id, role)
-		VALUES (?, ?, ?)
+		INSERT INTO room_members (room_id, user_id, role, invite_id)
+		VALUES (?, ?, ?, ?)
 	`
-	result, err := r.db.ExecContext(ctx, query, member.RoomID, member.UserID, member.Role)
+	result, err := tx.ExecContext(ctx, query, member.RoomID, member.UserID, member.Role, member.InviteID)
 	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+			return ErrDuplicateMember
+		}
 		return err
 	}
 
@@ -35,7 +99,7 @@ func (r *RoomMemberRepository) Add(ctx context.Context, member *models.RoomMembe
 
 func (r *RoomMemberRepository) GetByRoomID(ctx context.Context, roomID uint64) ([]*models.RoomMember, error) {
 	query := `
-		SELECT id, room_id, user_id, role, joined_at, last_read_at
+		SELECT ` + memberColumns + `
 		FROM room_members WHERE room_id = ?
 	`
 	rows, err := r.db.QueryContext(ctx, query, roomID)
@@ -46,11 +110,7 @@ func (r *RoomMemberRepository) GetByRoomID(ctx context.Context, roomID uint64) (
 
 	var members []*models.RoomMember
 	for rows.Next() {
-		member := &models.RoomMember{}
-		err := rows.Scan(
-			&member.ID, &member.RoomID, &member.UserID,
-			&member.Role, &member.JoinedAt, &member.LastReadAt,
-		)
+		member, err := scanMember(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -61,18 +121,46 @@ func (r *RoomMemberRepository) GetByRoomID(ctx context.Context, roomID uint64) (
 
 func (r *RoomMemberRepository) GetMember(ctx context.Context, roomID, userID uint64) (*models.RoomMember, error) {
 	query := `
-		SELECT id, room_id, user_id, role, joined_at, last_read_at
+		SELECT ` + memberColumns + `
 		FROM room_members WHERE room_id = ? AND user_id = ?
 	`
-	member := &models.RoomMember{}
-	err := r.db.QueryRowContext(ctx, query, roomID, userID).Scan(
-		&member.ID, &member.RoomID, &member.UserID,
-		&member.Role, &member.JoinedAt, &member.LastReadAt,
-	)
+	return scanMember(r.db.QueryRowContext(ctx, query, roomID, userID))
+}
+
+// GetSuccessor returns the member who inherits a room from the leaving owner:
+// the longest-standing admin, or the longest-standing member when there is no admin
+func (r *RoomMemberRepository) GetSuccessor(ctx context.Context, roomID, ownerID uint64) (*models.RoomMember, error) {
+	query := `
+		SELECT ` + memberColumns + `
+		FROM room_members
+		WHERE room_id = ? AND user_id != ?
+		ORDER BY role = 'admin' DESC, joined_at ASC, id ASC
+		LIMIT 1
+	`
+	return scanMember(r.db.QueryRowContext(ctx, query, roomID, ownerID))
+}
+
+// GetByUserID returns the user's memberships, keyed by room ID
+func (r *RoomMemberRepository) GetByUserID(ctx context.Context, userID uint64) (map[uint64]*models.RoomMember, error) {
+	query := `
+		SELECT ` + memberColumns + `
+		FROM room_members WHERE user_id = ?
+	`
+	rows, err := r.db.QueryContext(ctx, query, userID)
 	if err != nil {
 		return nil, err
 	}
-	return member, nil
+	defer rows.Close()
+
+	members := make(map[uint64]*models.RoomMember)
+	for rows.Next() {
+		member, err := scanMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		members[member.RoomID] = member
+	}
+	return members, nil
 }
 
 func (r *RoomMemberRepository) IsMember(ctx context.Context, roomID, userID uint64) (bool, error) {
@@ -82,16 +170,67 @@ func (r *RoomMemberRepository) IsMember(ctx context.Context, roomID, userID uint
 	return exists, err
 }
 
+func (r *RoomMemberRepository) UpdateRole(ctx context.Context, roomID, userID uint64, role models.MemberRole) error {
+	query := `UPDATE room_members SET role = ? WHERE room_id = ? AND user_id = ?`
+	_, err := r.db.ExecContext(ctx, query, role, roomID, userID)
+	return err
+}
+
+// UpdateSettings saves the member's mute, archive and notification settings
+func (r *RoomMemberRepository) UpdateSettings(ctx context.Context, member *models.RoomMember) error {
+	query := `
+		UPDATE room_members SET muted_until = ?, archived = ?, notification_level = ?
+		WHERE room_id = ? AND user_id = ?
+	`
+	_, err := r.db.ExecContext(ctx, query,
+		member.MutedUntil, member.Archived, member.NotificationLevel, member.RoomID, member.UserID,
+	)
+	return err
+}
+
+// Unarchive brings the room back for members who archived it, except those in userIDs
+func (r *RoomMemberRepository) Unarchive(ctx context.Context, roomID uint64, exceptUserIDs []uint64) error {
+	query := `UPDATE room_members SET archived = FALSE WHERE room_id = ? AND archived = TRUE`
+	args := []interface{}{roomID}
+	if len(exceptUserIDs) > 0 {
+		query += ` AND user_id NOT IN (?` + repeatPlaceholder(len(exceptUserIDs)-1) + `)`
+		for _, id := range exceptUserIDs {
+			args = append(args, id)
+		}
+	}
+	_, err := r.db.ExecContext(ctx, query, args...)
+	return err
+}
+
 func (r *RoomMemberRepository) Remove(ctx context.Context, roomID, userID uint64) error {
 	query := `DELETE FROM room_members WHERE room_id = ? AND user_id = ?`
 	_, err := r.db.ExecContext(ctx, query, roomID, userID)
 	return err
 }
 
-func (r *RoomMemberRepository) UpdateLastRead(ctx context.Context, roomID, userID uint64) error {
-	query := `UPDATE room_members SET last_read_at = NOW() WHERE room_id = ? AND user_id = ?`
-	_, err := r.db.ExecContext(ctx, query, roomID, userID)
-	return err
+// UpdateLastRead moves the member's read position forward to messageID (or to the newest
+// message when messageID is 0) and returns the resulting position. It never moves backwards,
+// and IDs that don't belong to the room are clamped to the newest room message below them.
+func (r *RoomMemberRepository) UpdateLastRead(ctx context.Context, roomID, userID, messageID uint64) (uint64, error) {
+	query := `
+		UPDATE room_members
+		SET last_read_message_id = GREATEST(
+				COALESCE(last_read_message_id, 0),
+				(SELECT COALESCE(MAX(id), 0) FROM messages WHERE room_id = ? AND (? = 0 OR id <= ?))
+			),
+			last_read_at = NOW()
+		WHERE room_id = ? AND user_id = ?
+	`
+	if _, err := r.db.ExecContext(ctx, query, roomID, messageID, messageID, roomID, userID); err != nil {
+		return 0, err
+	}
+
+	var lastRead sql.NullInt64
+	err := r.db.QueryRowContext(ctx,
+		`SELECT last_read_message_id FROM room_members WHERE room_id = ? AND user_id = ?`,
+		roomID, userID,
+	).Scan(&lastRead)
+	return uint64(lastRead.Int64), err
 }
 
 func (r *RoomMemberRepository) GetUserIDsByRoomID(ctx context.Context, roomID uint64) ([]uint64, error) {
@@ -112,3 +251,47 @@ func (r *RoomMemberRepository) GetUserIDsByRoomID(ctx context.Context, roomID ui
 	}
 	return userIDs, nil
 }
+
+// GetRoomPeerIDs returns everyone who shares at least one room with the user
+func (r *RoomMemberRepository) GetRoomPeerIDs(ctx context.Context, userID uint64) ([]uint64, error) {
+	query := `
+		SELECT DISTINCT peer.user_id FROM room_members rm
+		INNER JOIN room_members peer ON peer.room_id = rm.room_id
+		WHERE rm.user_id = ? AND peer.user_id != ?
+	`
+	rows, err := r.db.QueryContext(ctx, query, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIDs []uint64
+	for rows.Next() {
+		var peerID uint64
+		if err := rows.Scan(&peerID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, peerID)
+	}
+	return userIDs, nil
+}
+
+// GetRoomIDsByUserID returns the IDs of every room the user is a member of
+func (r *RoomMemberRepository) GetRoomIDsByUserID(ctx context.Context, userID uint64) ([]uint64, error) {
+	query := `SELECT room_id FROM room_members WHERE user_id = ?`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roomIDs []uint64
+	for rows.Next() {
+		var roomID uint64
+		if err := rows.Scan(&roomID); err != nil {
+			return nil, err
+		}
+		roomIDs = append(roomIDs, roomID)
+	}
+	return roomIDs, nil
+}
@@ -3,10 +3,40 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"strings"
 
 	"Mmessenger/internal/models"
+
+	"github.com/go-sql-driver/mysql"
 )
 
+// ErrDuplicateDirectRoom is returned by Create when the pair already has a direct message room
+var ErrDuplicateDirectRoom = errors.New("direct message room already exists")
+
+// ErrOwnershipChanged is returned by the ownership transfers when the previous owner no longer
+// owns the room or the new owner is no longer a member, i.e. a concurrent change won the race
+var ErrOwnershipChanged = errors.New("room ownership changed concurrently")
+
+// roomColumns is the column list scanned by scanRoom
+const roomColumns = `r.id, r.name, r.description, r.room_type, r.visibility, r.dm_key, r.owner_id, r.avatar_url,
+		r.max_members, r.edit_window_seconds, r.created_at, r.updated_at`
+
+// scanRoom scans roomColumns followed by any extra selected columns into extra
+func scanRoom(row rowScanner, extra ...interface{}) (*models.Room, error) {
+	room := &models.Room{}
+	dest := []interface{}{
+		&room.ID, &room.Name, &room.Description, &room.RoomType, &room.Visibility, &room.DMKey,
+		&room.OwnerID, &room.AvatarURL, &room.MaxMembers, &room.EditWindowSeconds,
+		&room.CreatedAt, &room.UpdatedAt,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
 type RoomRepository struct {
 	db *sql.DB
 }
@@ -15,15 +45,27 @@ func NewRoomRepository(db *sql.DB) *RoomRepository {
 	return &RoomRepository{db: db}
 }
 
-func (r *RoomRepository) Create(ctx context.Context, room *models.Room) error {
+// Create inserts the room together with its initial members in one transaction, so a failed
+// member insert never leaves a room behind without its owner
+func (r *RoomRepository) Create(ctx context.Context, room *models.Room, members []*models.RoomMember) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
-		INSERT INTO rooms (name, description, room_type, owner_id, max_members)
-		VALUES (?, ?, ?, ?, ?)
+		INSERT INTO rooms (name, description, room_type, visibility, dm_key, owner_id, max_members)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
 	`
-	result, err := r.db.ExecContext(ctx, query,
-		room.Name, room.Description, room.RoomType, room.OwnerID, room.MaxMembers,
+	result, err := tx.ExecContext(ctx, query,
+		room.Name, room.Description, room.RoomType, room.Visibility, room.DMKey, room.OwnerID, room.MaxMembers,
 	)
 	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+			return ErrDuplicateDirectRoom
+		}
 		return err
 	}
 
@@ -31,30 +73,41 @@ func (r *RoomRepository) Create(ctx context.Context, room *models.Room) error {
 	if err != nil {
 		return err
 	}
+
+	for _, member := range members {
+		member.RoomID = uint64(id)
+		if err := addMember(ctx, tx, member); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
 	room.ID = uint64(id)
 	return nil
 }
 
 func (r *RoomRepository) GetByID(ctx context.Context, id uint64) (*models.Room, error) {
 	query := `
-		SELECT id, name, description, room_type, owner_id, avatar_url, max_members, created_at, updated_at
-		FROM rooms WHERE id = ?
+		SELECT ` + roomColumns + `
+		FROM rooms r WHERE r.id = ?
 	`
-	room := &models.Room{}
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&room.ID, &room.Name, &room.Description, &room.RoomType,
-		&room.OwnerID, &room.AvatarURL, &room.MaxMembers,
-		&room.CreatedAt, &room.UpdatedAt,
-	)
-	if err != nil {
-		return nil, err
-	}
-	return room, nil
+	return scanRoom(r.db.QueryRowContext(ctx, query, id))
+}
+
+// GetByDMKey returns the direct message room with the given DirectRoomKey
+func (r *RoomRepository) GetByDMKey(ctx context.Context, dmKey string) (*models.Room, error) {
+	query := `
+		SELECT ` + roomColumns + `
+		FROM rooms r WHERE r.dm_key = ?
+	`
+	return scanRoom(r.db.QueryRowContext(ctx, query, dmKey))
 }
 
 func (r *RoomRepository) GetByUserID(ctx context.Context, userID uint64) ([]*models.Room, error) {
 	query := `
-		SELECT r.id, r.name, r.description, r.room_type, r.owner_id, r.avatar_url, r.max_members, r.created_at, r.updated_at
+		SELECT ` + roomColumns + `
 		FROM rooms r
 		INNER JOIN room_members rm ON r.id = rm.room_id
 		WHERE rm.user_id = ?
@@ -68,12 +121,7 @@ func (r *RoomRepository) GetByUserID(ctx context.Context, userID uint64) ([]*mod
 
 	var rooms []*models.Room
 	for rows.Next() {
-		room := &models.Room{}
-		err := rows.Scan(
-			&room.ID, &room.Name, &room.Description, &room.RoomType,
-			&room.OwnerID, &room.AvatarURL, &room.MaxMembers,
-			&room.CreatedAt, &room.UpdatedAt,
-		)
+		room, err := scanRoom(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -82,13 +130,169 @@ func (r *RoomRepository) GetByUserID(ctx context.Context, userID uint64) ([]*mod
 	return rooms, nil
 }
 
+// SearchPublic lists public rooms, newest first, whose name or description contains
+// filter.Query, with their member counts and whether userID has joined them
+func (r *RoomRepository) SearchPublic(ctx context.Context, userID uint64, filter *models.RoomDirectoryFilter) ([]*models.RoomDirectoryEntry, error) {
+	query := `
+		SELECT ` + roomColumns + `,
+			(SELECT COUNT(*) FROM room_members rm WHERE rm.room_id = r.id),
+			EXISTS(SELECT 1 FROM room_members rm WHERE rm.room_id = r.id AND rm.user_id = ?)
+		FROM rooms r
+		WHERE r.visibility = 'public'
+	`
+	args := []interface{}{userID}
+
+	if filter.Query != "" {
+		query += ` AND (r.name LIKE ? OR r.description LIKE ?)`
+		pattern := "%" + escapeLike(filter.Query) + "%"
+		args = append(args, pattern, pattern)
+	}
+	if filter.BeforeID > 0 {
+		query += ` AND r.id < ?`
+		args = append(args, filter.BeforeID)
+	}
+	query += ` ORDER BY r.id DESC LIMIT ?`
+	args = append(args, filter.Limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*models.RoomDirectoryEntry
+	for rows.Next() {
+		entry := &models.RoomDirectoryEntry{}
+		room, err := scanRoom(rows, &entry.MemberCount, &entry.IsMember)
+		if err != nil {
+			return nil, err
+		}
+		entry.Room = room
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Update saves the room's editable fields in one transaction. When max_members changes it
+// fails with ErrRoomFull if the room already has more members than that; the room row is
+// locked so no one can join in between.
 func (r *RoomRepository) Update(ctx context.Context, room *models.Room) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT max_members FROM rooms WHERE id = ? FOR UPDATE`, room.ID,
+	).Scan(&current); err != nil {
+		return err
+	}
+
+	if room.MaxMembers != current {
+		var count int
+		if err := tx.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM room_members WHERE room_id = ?`, room.ID,
+		).Scan(&count); err != nil {
+			return err
+		}
+		if count > room.MaxMembers {
+			return ErrRoomFull
+		}
+	}
+
 	query := `
-		UPDATE rooms SET name = ?, description = ?, updated_at = NOW()
+		UPDATE rooms SET name = ?, description = ?, visibility = ?, edit_window_seconds = ?, max_members = ?,
+			updated_at = NOW()
 		WHERE id = ?
 	`
-	_, err := r.db.ExecContext(ctx, query, room.Name, room.Description, room.ID)
-	return err
+	if _, err := tx.ExecContext(ctx, query,
+		room.Name, room.Description, room.Visibility, room.EditWindowSeconds, room.MaxMembers, room.ID,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// TransferOwnership makes newOwnerID the owner of the room and demotes the previous owner
+// to admin, in one transaction
+func (r *RoomRepository) TransferOwnership(ctx context.Context, roomID, previousOwnerID, newOwnerID uint64) error {
+	return r.transferOwnership(ctx, roomID, previousOwnerID, newOwnerID, false)
+}
+
+// TransferOwnershipAndLeave makes newOwnerID the owner of the room and removes the previous
+// owner from it, in one transaction
+func (r *RoomRepository) TransferOwnershipAndLeave(ctx context.Context, roomID, previousOwnerID, newOwnerID uint64) error {
+	return r.transferOwnership(ctx, roomID, previousOwnerID, newOwnerID, true)
+}
+
+func (r *RoomRepository) transferOwnership(ctx context.Context, roomID, previousOwnerID, newOwnerID uint64, leave bool) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Only the current owner can give the room away
+	result, err := tx.ExecContext(ctx,
+		`UPDATE rooms SET owner_id = ?, updated_at = NOW() WHERE id = ? AND owner_id = ?`,
+		newOwnerID, roomID, previousOwnerID,
+	)
+	if err != nil {
+		return err
+	}
+	if err := requireRowsAffected(result); err != nil {
+		return err
+	}
+
+	if leave {
+		if _, err := tx.ExecContext(ctx,
+			`DELETE FROM room_members WHERE room_id = ? AND user_id = ?`, roomID, previousOwnerID,
+		); err != nil {
+			return err
+		}
+	} else {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE room_members SET role = ? WHERE room_id = ? AND user_id = ?`,
+			models.MemberRoleAdmin, roomID, previousOwnerID,
+		); err != nil {
+			return err
+		}
+	}
+
+	// The new owner may have left in the meantime
+	result, err = tx.ExecContext(ctx,
+		`UPDATE room_members SET role = ? WHERE room_id = ? AND user_id = ?`,
+		models.MemberRoleOwner, roomID, newOwnerID,
+	)
+	if err != nil {
+		return err
+	}
+	if err := requireRowsAffected(result); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// requireRowsAffected turns an ownership transfer statement that matched nothing into ErrOwnershipChanged
+func requireRowsAffected(result sql.Result) error {
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrOwnershipChanged
+	}
+	return nil
 }
 
 func (r *RoomRepository) Delete(ctx context.Context, id uint64) error {
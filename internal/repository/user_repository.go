@@ -105,10 +105,68 @@ func (r *UserRepository) GetByKeycloakID(ctx context.Context, keycloakID string)
 	return user, nil
 }
 
-func (r *UserRepository) UpdateStatus(ctx context.Context, userID uint64, status models.UserStatus) error {
-	query := `UPDATE users SET status = ?, last_seen_at = NOW() WHERE id = ?`
-	_, err := r.db.ExecContext(ctx, query, status, userID)
-	return err
+// SetStatus changes the user's status and stamps last_seen_at. It reports false when the
+// user already had that status, so concurrent servers announce a change only once.
+func (r *UserRepository) SetStatus(ctx context.Context, userID uint64, status models.UserStatus) (bool, error) {
+	query := `UPDATE users SET status = ?, last_seen_at = NOW() WHERE id = ? AND status != ?`
+	result, err := r.db.ExecContext(ctx, query, status, userID, status)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// GetActiveStatuses returns the recorded status of every user who is online or away
+func (r *UserRepository) GetActiveStatuses(ctx context.Context) (map[uint64]models.UserStatus, error) {
+	query := `SELECT id, status FROM users WHERE status != 'offline'`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	statuses := make(map[uint64]models.UserStatus)
+	for rows.Next() {
+		var userID uint64
+		var status models.UserStatus
+		if err := rows.Scan(&userID, &status); err != nil {
+			return nil, err
+		}
+		statuses[userID] = status
+	}
+	return statuses, nil
+}
+
+// GetLastSeen returns when each of the existing users was last seen; users never seen
+// map to an invalid time
+func (r *UserRepository) GetLastSeen(ctx context.Context, userIDs []uint64) (map[uint64]sql.NullTime, error) {
+	lastSeen := make(map[uint64]sql.NullTime, len(userIDs))
+	if len(userIDs) == 0 {
+		return lastSeen, nil
+	}
+
+	query := `SELECT id, last_seen_at FROM users WHERE id IN (?` + repeatPlaceholder(len(userIDs)-1) + `)`
+	args := make([]interface{}, len(userIDs))
+	for i, id := range userIDs {
+		args[i] = id
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID uint64
+		var seen sql.NullTime
+		if err := rows.Scan(&userID, &seen); err != nil {
+			return nil, err
+		}
+		lastSeen[userID] = seen
+	}
+	return lastSeen, nil
 }
 
 func (r *UserRepository) UpdateKeycloakID(ctx context.Context, userID uint64, keycloakID string) error {
@@ -35,11 +35,6 @@ func (s *AuthService) GetOrCreateUserFromKeycloak(ctx context.Context, claims *k
 	user, err := s.userRepo.GetByKeycloakID(ctx, claims.Subject)
 	if err == nil {
 		log.Printf("[AuthService] Found existing user by KeycloakID: ID=%d", user.ID)
-		if err := s.userRepo.UpdateStatus(ctx, user.ID, models.UserStatusOnline); err != nil {
-			log.Printf("[AuthService] Failed to update status: %v", err)
-			return nil, err
-		}
-		user.Status = models.UserStatusOnline
 		return user, nil
 	}
 
@@ -58,12 +53,7 @@ func (s *AuthService) GetOrCreateUserFromKeycloak(ctx context.Context, claims *k
 			log.Printf("[AuthService] Failed to update KeycloakID: %v", err)
 			return nil, err
 		}
-		if err := s.userRepo.UpdateStatus(ctx, user.ID, models.UserStatusOnline); err != nil {
-			log.Printf("[AuthService] Failed to update status: %v", err)
-			return nil, err
-		}
 		user.KeycloakID = sql.NullString{String: claims.Subject, Valid: true}
-		user.Status = models.UserStatusOnline
 		return user, nil
 	}
 
@@ -84,6 +74,8 @@ func (s *AuthService) GetOrCreateUserFromKeycloak(ctx context.Context, claims *k
 		KeycloakID: sql.NullString{String: claims.Subject, Valid: true},
 		Email:      claims.Email,
 		Username:   username,
+		// Presence takes the user online once they connect
+		Status: models.UserStatusOffline,
 	}
 
 	if err := s.userRepo.Create(ctx, user); err != nil {
@@ -93,12 +85,6 @@ func (s *AuthService) GetOrCreateUserFromKeycloak(ctx context.Context, claims *k
 
 	log.Printf("[AuthService] Created new user: ID=%d", user.ID)
 
-	if err := s.userRepo.UpdateStatus(ctx, user.ID, models.UserStatusOnline); err != nil {
-		log.Printf("[AuthService] Failed to update status for new user: %v", err)
-		return nil, err
-	}
-	user.Status = models.UserStatusOnline
-
 	return user, nil
 }
 
@@ -109,7 +95,3 @@ func (s *AuthService) GetUserByKeycloakID(ctx context.Context, keycloakID string
 func (s *AuthService) GetUserByID(ctx context.Context, userID uint64) (*models.User, error) {
 	return s.userRepo.GetByID(ctx, userID)
 }
-
-func (s *AuthService) Logout(ctx context.Context, userID uint64) error {
-	return s.userRepo.UpdateStatus(ctx, userID, models.UserStatusOffline)
-}
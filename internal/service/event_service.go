@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"Mmessenger/internal/models"
+	"Mmessenger/internal/repository"
+)
+
+const (
+	// eventRetention is how long missed events can still be replayed
+	eventRetention = 24 * time.Hour
+	// maxReplayEvents keeps a replay within the client send buffer; larger gaps require a resync
+	maxReplayEvents    = 200
+	eventPruneInterval = time.Hour
+)
+
+var (
+	ErrResyncRequired = errors.New("missed events are no longer available")
+)
+
+// EventService keeps the replay log of WebSocket events
+type EventService struct {
+	eventRepo *repository.EventRepository
+}
+
+func NewEventService(eventRepo *repository.EventRepository) *EventService {
+	return &EventService{eventRepo: eventRepo}
+}
+
+// Record appends an event to the log and assigns its sequence number
+func (s *EventService) Record(ctx context.Context, event *models.Event) error {
+	return s.eventRepo.Create(ctx, event)
+}
+
+// LatestSeq returns the newest sequence number, where a client without history starts from
+func (s *EventService) LatestSeq(ctx context.Context) (uint64, error) {
+	_, latest, err := s.eventRepo.GetIDRange(ctx)
+	return latest, err
+}
+
+// Replay returns the user's events after lastSeq. It fails with ErrResyncRequired when some
+// of them were already pruned or there are too many to replay.
+func (s *EventService) Replay(ctx context.Context, userID, lastSeq uint64) ([]*models.Event, error) {
+	oldest, latest, err := s.eventRepo.GetIDRange(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if lastSeq > latest || (oldest > 0 && lastSeq+1 < oldest) {
+		return nil, ErrResyncRequired
+	}
+
+	events, err := s.eventRepo.GetForUser(ctx, userID, lastSeq, maxReplayEvents+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) > maxReplayEvents {
+		return nil, ErrResyncRequired
+	}
+	return events, nil
+}
+
+// RunRetention prunes expired events until ctx is done
+func (s *EventService) RunRetention(ctx context.Context) {
+	ticker := time.NewTicker(eventPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := s.eventRepo.DeleteBefore(ctx, time.Now().Add(-eventRetention))
+			if err != nil {
+				log.Printf("[EventService] Failed to prune events: %v", err)
+				continue
+			}
+			if deleted > 0 {
+				log.Printf("[EventService] Pruned %d expired events", deleted)
+			}
+		}
+	}
+}
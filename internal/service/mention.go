@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"Mmessenger/internal/models"
+)
+
+// mentionPattern matches @name tokens that start a word, so e-mail addresses are not mentions
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@])@([\p{L}\p{N}_.\-]+)`)
+
+// parseMentions returns the distinct names mentioned in content, in order of appearance
+func parseMentions(content string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		// "@alice." at the end of a sentence mentions alice
+		name := strings.TrimRight(match[1], ".-")
+		key := strings.ToLower(name)
+		if name == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// resolveMentions turns the mentions in content into one row per mentioned room member.
+// Unknown users, non-members and the sender are dropped. A member reached several ways
+// keeps the most specific mention: @username, then @here, then @all.
+func (s *MessageService) resolveMentions(ctx context.Context, msg *models.Message) ([]*models.MessageMention, error) {
+	names := parseMentions(msg.Content)
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	types := make(map[uint64]models.MentionType)
+	var order []uint64
+	mention := func(userID uint64, mentionType models.MentionType) {
+		if userID == msg.SenderID {
+			return
+		}
+		current, ok := types[userID]
+		if !ok {
+			order = append(order, userID)
+		}
+		if !ok || mentionRank(mentionType) < mentionRank(current) {
+			types[userID] = mentionType
+		}
+	}
+
+	for _, name := range names {
+		var userIDs []uint64
+		var err error
+		mentionType := models.MentionTypeUser
+
+		switch strings.ToLower(name) {
+		case string(models.MentionTypeAll):
+			mentionType = models.MentionTypeAll
+			userIDs, err = s.memberRepo.GetUserIDsByRoomID(ctx, msg.RoomID)
+		case string(models.MentionTypeHere):
+			mentionType = models.MentionTypeHere
+			userIDs, err = s.connectedMembers(ctx, msg.RoomID)
+		default:
+			userIDs, err = s.mentionedMember(ctx, msg.RoomID, name)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, userID := range userIDs {
+			mention(userID, mentionType)
+		}
+	}
+
+	mentions := make([]*models.MessageMention, 0, len(order))
+	for _, userID := range order {
+		mentions = append(mentions, &models.MessageMention{
+			MessageID:   msg.ID,
+			RoomID:      msg.RoomID,
+			UserID:      userID,
+			MentionType: types[userID],
+		})
+	}
+	return mentions, nil
+}
+
+// connectedMembers returns the members of the room connected anywhere in the cluster,
+// online or away
+func (s *MessageService) connectedMembers(ctx context.Context, roomID uint64) ([]uint64, error) {
+	memberIDs, err := s.memberRepo.GetUserIDsByRoomID(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	return s.presenceService.ConnectedUserIDs(ctx, memberIDs)
+}
+
+// mentionedMember looks up @username, returning nothing unless the user is in the room
+func (s *MessageService) mentionedMember(ctx context.Context, roomID uint64, username string) ([]uint64, error) {
+	user, err := s.userRepo.GetByUsername(ctx, username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	isMember, err := s.memberRepo.IsMember(ctx, roomID, user.ID)
+	if err != nil || !isMember {
+		return nil, err
+	}
+	return []uint64{user.ID}, nil
+}
+
+func mentionRank(t models.MentionType) int {
+	switch t {
+	case models.MentionTypeUser:
+		return 0
+	case models.MentionTypeHere:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// storeMentions records the mentions in a newly created message and returns them as
+// responses along with the IDs of the mentioned users
+func (s *MessageService) storeMentions(ctx context.Context, msg *models.Message) ([]*models.MentionResponse, []uint64, error) {
+	mentions, err := s.resolveMentions(ctx, msg)
+	if err != nil || len(mentions) == 0 {
+		return nil, nil, err
+	}
+	if err := s.mentionRepo.CreateBatch(ctx, mentions); err != nil {
+		return nil, nil, err
+	}
+
+	userIDs := make([]uint64, len(mentions))
+	for i, m := range mentions {
+		userIDs[i] = m.UserID
+	}
+
+	written, err := s.mentionRepo.GetByMessageIDs(ctx, []uint64{msg.ID})
+	if err != nil {
+		return nil, userIDs, err
+	}
+	return s.toMentionResponses(ctx, written[msg.ID], nil), userIDs, nil
+}
+
+// toMentionResponses converts mentions as written (see MentionRepository.GetByMessageIDs)
+// to responses, dropping user mentions whose user no longer exists
+func (s *MessageService) toMentionResponses(ctx context.Context, mentions []*models.MessageMention, userCache map[uint64]*models.UserResponse) []*models.MentionResponse {
+	responses := make([]*models.MentionResponse, 0, len(mentions))
+	for _, m := range mentions {
+		resp := &models.MentionResponse{Type: m.MentionType}
+		if m.MentionType == models.MentionTypeUser {
+			if resp.User = s.senderResponse(ctx, m.UserID, userCache); resp.User == nil {
+				continue
+			}
+		}
+		responses = append(responses, resp)
+	}
+	return responses
+}
+
+// GetMentions returns the messages that mentioned the user, newest first.
+// beforeID is the next_cursor of the previous page; 0 starts from the newest mention.
+func (s *MessageService) GetMentions(ctx context.Context, userID, beforeID uint64, limit int) (*models.MentionInboxResponse, error) {
+	mentions, err := s.mentionRepo.GetForUser(ctx, userID, beforeID, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &models.MentionInboxResponse{
+		Mentions: []*models.MentionInboxItem{},
+		HasMore:  len(mentions) > limit,
+	}
+	if resp.HasMore {
+		mentions = mentions[:limit]
+		cursor := strconv.FormatUint(mentions[len(mentions)-1].ID, 10)
+		resp.NextCursor = &cursor
+	}
+
+	messageIDs := make([]uint64, len(mentions))
+	for i, m := range mentions {
+		messageIDs[i] = m.MessageID
+	}
+	byID, err := s.messageRepo.GetByIDs(ctx, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]*models.Message, 0, len(mentions))
+	for _, m := range mentions {
+		if msg, ok := byID[m.MessageID]; ok {
+			messages = append(messages, msg)
+		}
+	}
+	responses := make(map[uint64]*models.MessageResponse, len(messages))
+	for _, r := range s.toResponses(ctx, userID, messages) {
+		responses[r.ID] = r
+	}
+
+	for _, m := range mentions {
+		msg, ok := responses[m.MessageID]
+		if !ok {
+			log.Printf("[MessageService] Mentioned message %d not found", m.MessageID)
+			continue
+		}
+		resp.Mentions = append(resp.Mentions, &models.MentionInboxItem{
+			Message:     msg,
+			MentionType: m.MentionType,
+			MentionedAt: m.CreatedAt,
+		})
+	}
+	return resp, nil
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"Mmessenger/internal/models"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"no mentions", "hello world", nil},
+		{"single", "hi @alice", []string{"alice"}},
+		{"start of message", "@bob are you there", []string{"bob"}},
+		{"several in order", "@carol and @alice", []string{"carol", "alice"}},
+		{"duplicates ignore case", "@Alice @alice @ALICE", []string{"Alice"}},
+		{"trailing punctuation", "thanks @alice.", []string{"alice"}},
+		{"trailing hyphen", "@bob- see above", []string{"bob"}},
+		{"dots inside name", "ping @john.doe now", []string{"john.doe"}},
+		{"email address", "mail alice@example.com", nil},
+		{"double at", "@@alice", nil},
+		{"after punctuation", "(@alice) ,@bob", []string{"alice", "bob"}},
+		{"unicode name", "안녕 @홍길동", []string{"홍길동"}},
+		{"here and all", "@here @all", []string{"here", "all"}},
+		{"bare at", "look @ this", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseMentions(tt.content); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMentions(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMentionRank(t *testing.T) {
+	// A more specific mention must rank lower so it wins when a member is reached twice
+	user := mentionRank(models.MentionTypeUser)
+	here := mentionRank(models.MentionTypeHere)
+	all := mentionRank(models.MentionTypeAll)
+	if !(user < here && here < all) {
+		t.Errorf("mention ranks out of order: user=%d here=%d all=%d", user, here, all)
+	}
+}
@@ -3,32 +3,76 @@ package service
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"log"
+	"strconv"
+	"time"
 
 	"Mmessenger/internal/models"
 	"Mmessenger/internal/repository"
 )
 
+var (
+	ErrMessageNotFound = errors.New("message not found")
+	ErrInvalidParent   = errors.New("parent message not found in this room")
+	ErrEmptySearchTerm = errors.New("search query has no searchable terms")
+	ErrEditWindowPast  = errors.New("message can no longer be edited")
+	ErrSystemMessage   = errors.New("system messages are written by the server")
+
+	ErrInvalidClientMessageID = errors.New("client message id must be at most 64 characters")
+	ErrClientMessageIDInUse   = errors.New("client message id already used in another room")
+)
+
+// maxClientMessageIDLength matches messages.client_message_id
+const maxClientMessageIDLength = 64
+
 type MessageService struct {
-	messageRepo *repository.MessageRepository
-	memberRepo  *repository.RoomMemberRepository
-	userRepo    *repository.UserRepository
+	messageRepo  *repository.MessageRepository
+	memberRepo   *repository.RoomMemberRepository
+	userRepo     *repository.UserRepository
+	reactionRepo *repository.ReactionRepository
+	roomRepo     *repository.RoomRepository
+	pinRepo      *repository.PinRepository
+	mentionRepo  *repository.MentionRepository
+
+	presenceService *PresenceService
 }
 
-func NewMessageService(messageRepo *repository.MessageRepository, memberRepo *repository.RoomMemberRepository, userRepo *repository.UserRepository) *MessageService {
+func NewMessageService(messageRepo *repository.MessageRepository, memberRepo *repository.RoomMemberRepository, userRepo *repository.UserRepository, reactionRepo *repository.ReactionRepository, roomRepo *repository.RoomRepository, pinRepo *repository.PinRepository, mentionRepo *repository.MentionRepository, presenceService *PresenceService) *MessageService {
 	return &MessageService{
-		messageRepo: messageRepo,
-		memberRepo:  memberRepo,
-		userRepo:    userRepo,
+		messageRepo:     messageRepo,
+		memberRepo:      memberRepo,
+		userRepo:        userRepo,
+		reactionRepo:    reactionRepo,
+		roomRepo:        roomRepo,
+		pinRepo:         pinRepo,
+		mentionRepo:     mentionRepo,
+		presenceService: presenceService,
 	}
 }
 
-func (s *MessageService) Create(ctx context.Context, roomID, senderID uint64, req *models.SendMessageRequest) (*models.MessageResponse, error) {
+// Create stores a new message. When req.ClientMessageID matches a message the sender already
+// stored, that message is returned instead and created is false.
+func (s *MessageService) Create(ctx context.Context, roomID, senderID uint64, req *models.SendMessageRequest) (resp *models.MessageResponse, created bool, err error) {
 	isMember, err := s.memberRepo.IsMember(ctx, roomID, senderID)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 	if !isMember {
-		return nil, ErrNotMember
+		return nil, false, ErrNotMember
+	}
+
+	if req.MessageType == models.MessageTypeSystem {
+		return nil, false, ErrSystemMessage
+	}
+	if len(req.ClientMessageID) > maxClientMessageIDLength {
+		return nil, false, ErrInvalidClientMessageID
+	}
+	if req.ClientMessageID != "" {
+		existing, err := s.getByClientMessageID(ctx, roomID, senderID, req.ClientMessageID)
+		if err != nil || existing != nil {
+			return existing, false, err
+		}
 	}
 
 	msg := &models.Message{
@@ -50,52 +94,175 @@ func (s *MessageService) Create(ctx context.Context, roomID, senderID uint64, re
 		msg.ThumbnailURL = sql.NullString{String: req.ThumbnailURL, Valid: true}
 	}
 
+	var parent *models.Message
+	if req.ParentID != 0 {
+		parent, err = s.messageRepo.GetByID(ctx, req.ParentID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, false, ErrInvalidParent
+			}
+			return nil, false, err
+		}
+		if parent.RoomID != roomID || parent.IsDeleted {
+			return nil, false, ErrInvalidParent
+		}
+		msg.ParentID = sql.NullInt64{Int64: int64(parent.ID), Valid: true}
+	}
+
+	if req.ClientMessageID != "" {
+		msg.ClientMessageID = sql.NullString{String: req.ClientMessageID, Valid: true}
+	}
+
 	if err := s.messageRepo.Create(ctx, msg); err != nil {
-		return nil, err
+		if errors.Is(err, repository.ErrDuplicateClientMessageID) {
+			// A concurrent resend won the insert
+			existing, err := s.getByClientMessageID(ctx, roomID, senderID, req.ClientMessageID)
+			if err == nil && existing == nil {
+				err = repository.ErrDuplicateClientMessageID
+			}
+			return existing, false, err
+		}
+		return nil, false, err
 	}
 
 	// Get unread count (all members except sender haven't read yet)
-	unreadCount, _ := s.messageRepo.GetUnreadCount(ctx, roomID, msg.CreatedAt, senderID)
+	unreadCount, _ := s.messageRepo.GetUnreadCount(ctx, roomID, msg.ID, senderID)
 
 	sender, _ := s.userRepo.GetByID(ctx, senderID)
-	return msg.ToResponse(sender.ToResponse(), unreadCount), nil
+	resp = msg.ToResponse(sender.ToResponse(), unreadCount)
+	if parent != nil {
+		resp.ReplyTo = parent.ToPreview(s.senderResponse(ctx, parent.SenderID, nil))
+	}
+	if resp.Mentions, resp.MentionedUserIDs, err = s.storeMentions(ctx, msg); err != nil {
+		log.Printf("[MessageService] Failed to store mentions for message %d: %v", msg.ID, err)
+	}
+	return resp, true, nil
 }
 
-func (s *MessageService) GetByRoomID(ctx context.Context, roomID, userID uint64, limit, offset int) ([]*models.MessageResponse, error) {
-	isMember, err := s.memberRepo.IsMember(ctx, roomID, userID)
+// getByClientMessageID looks up a previously stored send; it returns nil when there is none
+func (s *MessageService) getByClientMessageID(ctx context.Context, roomID, senderID uint64, clientMessageID string) (*models.MessageResponse, error) {
+	msg, err := s.messageRepo.GetByClientMessageID(ctx, senderID, clientMessageID)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
 		return nil, err
 	}
-	if !isMember {
-		return nil, ErrNotMember
+	if msg.RoomID != roomID {
+		return nil, ErrClientMessageIDInUse
 	}
 
-	messages, err := s.messageRepo.GetByRoomID(ctx, roomID, limit, offset)
+	return s.toResponses(ctx, senderID, []*models.Message{msg})[0], nil
+}
+
+// GetPage returns a page of room history selected by cursor
+func (s *MessageService) GetPage(ctx context.Context, roomID, userID uint64, cursor *models.MessageCursor) (*models.MessagePage, error) {
+	isMember, err := s.memberRepo.IsMember(ctx, roomID, userID)
 	if err != nil {
 		return nil, err
 	}
+	if !isMember {
+		return nil, ErrNotMember
+	}
 
-	// Cache users
-	userCache := make(map[uint64]*models.UserResponse)
+	// Each query fetches one extra row to know whether more messages exist that way
+	var messages []*models.Message
+	var hasOlder, hasNewer, hasMore bool
 
-	var responses []*models.MessageResponse
-	for _, msg := range messages {
-		sender, ok := userCache[msg.SenderID]
-		if !ok {
-			user, err := s.userRepo.GetByID(ctx, msg.SenderID)
-			if err == nil {
-				sender = user.ToResponse()
-				userCache[msg.SenderID] = sender
+	switch {
+	case cursor.AroundID != 0:
+		target, err := s.messageRepo.GetByID(ctx, cursor.AroundID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, ErrMessageNotFound
 			}
+			return nil, err
+		}
+		if target.RoomID != roomID {
+			return nil, ErrMessageNotFound
 		}
-		unreadCount, _ := s.messageRepo.GetUnreadCount(ctx, roomID, msg.CreatedAt, msg.SenderID)
-		responses = append(responses, msg.ToResponse(sender, unreadCount))
+
+		olderLimit := cursor.Limit / 2
+		newerLimit := cursor.Limit - olderLimit - 1
+
+		older, err := s.messageRepo.GetByRoomIDBefore(ctx, roomID, target.ID, olderLimit+1)
+		if err != nil {
+			return nil, err
+		}
+		older, hasOlder = trimOlder(older, olderLimit)
+
+		newer, err := s.messageRepo.GetByRoomIDAfter(ctx, roomID, target.ID, newerLimit+1)
+		if err != nil {
+			return nil, err
+		}
+		newer, hasNewer = trimNewer(newer, newerLimit)
+
+		messages = append(append(older, target), newer...)
+		hasMore = hasOlder || hasNewer
+
+	case cursor.AfterID != 0:
+		messages, err = s.messageRepo.GetByRoomIDAfter(ctx, roomID, cursor.AfterID, cursor.Limit+1)
+		if err != nil {
+			return nil, err
+		}
+		messages, hasNewer = trimNewer(messages, cursor.Limit)
+		hasOlder = true
+		hasMore = hasNewer
+
+	default:
+		messages, err = s.messageRepo.GetByRoomIDBefore(ctx, roomID, cursor.BeforeID, cursor.Limit+1)
+		if err != nil {
+			return nil, err
+		}
+		messages, hasOlder = trimOlder(messages, cursor.Limit)
+		hasNewer = cursor.BeforeID != 0
+		hasMore = hasOlder
 	}
-	return responses, nil
+
+	page := &models.MessagePage{
+		Messages: s.toResponses(ctx, userID, messages),
+		HasMore:  hasMore,
+	}
+	page.NextCursor, page.PrevCursor = pageCursors(messages, hasOlder, hasNewer)
+	return page, nil
+}
+
+// trimOlder cuts a chronological slice fetched with one extra row down to limit by
+// dropping its oldest messages, and reports whether anything was dropped
+func trimOlder(messages []*models.Message, limit int) ([]*models.Message, bool) {
+	if len(messages) <= limit {
+		return messages, false
+	}
+	return messages[len(messages)-limit:], true
+}
+
+// trimNewer cuts a chronological slice fetched with one extra row down to limit by
+// dropping its newest messages, and reports whether anything was dropped
+func trimNewer(messages []*models.Message, limit int) ([]*models.Message, bool) {
+	if len(messages) <= limit {
+		return messages, false
+	}
+	return messages[:limit], true
 }
 
-// GetByRoomIDAfter returns messages after a given message ID (for reconnection)
-func (s *MessageService) GetByRoomIDAfter(ctx context.Context, roomID, userID, afterID uint64, limit int) ([]*models.MessageResponse, error) {
+// pageCursors returns the before_id cursor for older messages and the after_id cursor
+// for newer ones; each is nil when nothing is left that way or the page is empty
+func pageCursors(messages []*models.Message, hasOlder, hasNewer bool) (next, prev *string) {
+	if len(messages) == 0 {
+		return nil, nil
+	}
+	if hasOlder {
+		id := strconv.FormatUint(messages[0].ID, 10)
+		next = &id
+	}
+	if hasNewer {
+		id := strconv.FormatUint(messages[len(messages)-1].ID, 10)
+		prev = &id
+	}
+	return next, prev
+}
+
+func (s *MessageService) GetByID(ctx context.Context, roomID, msgID, userID uint64) (*models.MessageResponse, error) {
 	isMember, err := s.memberRepo.IsMember(ctx, roomID, userID)
 	if err != nil {
 		return nil, err
@@ -104,31 +271,20 @@ func (s *MessageService) GetByRoomIDAfter(ctx context.Context, roomID, userID, a
 		return nil, ErrNotMember
 	}
 
-	messages, err := s.messageRepo.GetByRoomIDAfter(ctx, roomID, afterID, limit)
+	msg, err := s.messageRepo.GetByID(ctx, msgID)
 	if err != nil {
 		return nil, err
 	}
 
-	// Cache users
-	userCache := make(map[uint64]*models.UserResponse)
-
-	var responses []*models.MessageResponse
-	for _, msg := range messages {
-		sender, ok := userCache[msg.SenderID]
-		if !ok {
-			user, err := s.userRepo.GetByID(ctx, msg.SenderID)
-			if err == nil {
-				sender = user.ToResponse()
-				userCache[msg.SenderID] = sender
-			}
-		}
-		unreadCount, _ := s.messageRepo.GetUnreadCount(ctx, roomID, msg.CreatedAt, msg.SenderID)
-		responses = append(responses, msg.ToResponse(sender, unreadCount))
+	if msg.RoomID != roomID {
+		return nil, sql.ErrNoRows
 	}
-	return responses, nil
+
+	return s.toResponses(ctx, userID, []*models.Message{msg})[0], nil
 }
 
-func (s *MessageService) GetByID(ctx context.Context, roomID, msgID, userID uint64) (*models.MessageResponse, error) {
+// GetThread returns a parent message and a page of its replies, oldest first
+func (s *MessageService) GetThread(ctx context.Context, roomID, parentID, userID, afterID uint64, limit int) (*models.ThreadResponse, error) {
 	isMember, err := s.memberRepo.IsMember(ctx, roomID, userID)
 	if err != nil {
 		return nil, err
@@ -137,46 +293,313 @@ func (s *MessageService) GetByID(ctx context.Context, roomID, msgID, userID uint
 		return nil, ErrNotMember
 	}
 
-	msg, err := s.messageRepo.GetByID(ctx, msgID)
+	parent, err := s.messageRepo.GetByID(ctx, parentID)
 	if err != nil {
 		return nil, err
 	}
+	if parent.RoomID != roomID {
+		return nil, sql.ErrNoRows
+	}
 
-	unreadCount, _ := s.messageRepo.GetUnreadCount(ctx, roomID, msg.CreatedAt, msg.SenderID)
-	sender, _ := s.userRepo.GetByID(ctx, msg.SenderID)
-	return msg.ToResponse(sender.ToResponse(), unreadCount), nil
+	// Fetch one extra row to know whether another page exists
+	replies, err := s.messageRepo.GetThreadReplies(ctx, parentID, afterID, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	hasMore := len(replies) > limit
+	if hasMore {
+		replies = replies[:limit]
+	}
+
+	responses := s.toResponses(ctx, userID, append([]*models.Message{parent}, replies...))
+	return &models.ThreadResponse{
+		Parent:  responses[0],
+		Replies: responses[1:],
+		HasMore: hasMore,
+	}, nil
 }
 
-func (s *MessageService) Update(ctx context.Context, msgID, userID uint64, req *models.UpdateMessageRequest) (*models.MessageResponse, error) {
-	msg, err := s.messageRepo.GetByID(ctx, msgID)
+// Search finds messages matching filter.Query across every room the user is a member of
+func (s *MessageService) Search(ctx context.Context, userID uint64, filter *models.MessageSearchFilter) (*models.MessageSearchResponse, error) {
+	terms := searchTerms(filter.Query)
+	if len(terms) == 0 {
+		return nil, ErrEmptySearchTerm
+	}
+
+	var roomIDs []uint64
+	if filter.RoomID != 0 {
+		isMember, err := s.memberRepo.IsMember(ctx, filter.RoomID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if !isMember {
+			return nil, ErrNotMember
+		}
+		roomIDs = []uint64{filter.RoomID}
+	} else {
+		var err error
+		roomIDs, err = s.memberRepo.GetRoomIDsByUserID(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Fetch one extra row to know whether another page exists
+	limit := filter.Limit
+	filter.Limit = limit + 1
+	messages, err := s.messageRepo.Search(ctx, roomIDs, booleanQuery(terms), filter)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &models.MessageSearchResponse{
+		Results: []*models.MessageSearchResult{},
+		HasMore: len(messages) > limit,
+	}
+	if resp.HasMore {
+		messages = messages[:limit]
+		cursor := strconv.FormatUint(messages[len(messages)-1].ID, 10)
+		resp.NextCursor = &cursor
+	}
+
+	for i, msgResp := range s.toResponses(ctx, userID, messages) {
+		snippet, highlights := buildSnippet(messages[i].Content, terms)
+		resp.Results = append(resp.Results, &models.MessageSearchResult{
+			Message:    msgResp,
+			Snippet:    snippet,
+			Highlights: highlights,
+		})
+	}
+	return resp, nil
+}
+
+func (s *MessageService) Update(ctx context.Context, roomID, msgID, userID uint64, req *models.UpdateMessageRequest) (*models.MessageResponse, error) {
+	msg, err := s.getRoomMessage(ctx, roomID, msgID)
 	if err != nil {
 		return nil, err
 	}
 
+	if msg.MessageType == models.MessageTypeSystem {
+		return nil, ErrSystemMessage
+	}
 	if msg.SenderID != userID {
 		return nil, ErrNotOwner
 	}
 
+	room, err := s.roomRepo.GetByID(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if room.EditWindowSeconds.Valid {
+		window := time.Duration(room.EditWindowSeconds.Int64) * time.Second
+		if time.Since(msg.CreatedAt) > window {
+			return nil, ErrEditWindowPast
+		}
+	}
+
 	msg.Content = req.Content
-	if err := s.messageRepo.Update(ctx, msg); err != nil {
+	if err := s.messageRepo.Update(ctx, msg, userID); err != nil {
 		return nil, err
 	}
 
 	msg.IsEdited = true
-	unreadCount, _ := s.messageRepo.GetUnreadCount(ctx, msg.RoomID, msg.CreatedAt, msg.SenderID)
-	sender, _ := s.userRepo.GetByID(ctx, userID)
-	return msg.ToResponse(sender.ToResponse(), unreadCount), nil
+	return s.toResponses(ctx, userID, []*models.Message{msg})[0], nil
 }
 
-func (s *MessageService) Delete(ctx context.Context, msgID, userID uint64) error {
+// GetRevisions returns the edit history of a message to members allowed to view it
+func (s *MessageService) GetRevisions(ctx context.Context, roomID, msgID, userID uint64) ([]*models.MessageRevisionResponse, error) {
+	if _, err := requirePermission(ctx, s.memberRepo, roomID, userID, models.PermissionViewRevisions); err != nil {
+		return nil, err
+	}
+
 	msg, err := s.messageRepo.GetByID(ctx, msgID)
 	if err != nil {
-		return err
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, err
+	}
+	if msg.RoomID != roomID {
+		return nil, ErrMessageNotFound
+	}
+
+	revisions, err := s.messageRepo.GetRevisions(ctx, msgID)
+	if err != nil {
+		return nil, err
+	}
+
+	userCache := make(map[uint64]*models.UserResponse)
+	responses := make([]*models.MessageRevisionResponse, 0, len(revisions))
+	for _, rev := range revisions {
+		responses = append(responses, rev.ToResponse(s.senderResponse(ctx, rev.EditorID, userCache)))
+	}
+	return responses, nil
+}
+
+// MarkRead advances the user's read position in the room and returns it
+func (s *MessageService) MarkRead(ctx context.Context, roomID, userID, messageID uint64) (uint64, error) {
+	isMember, err := s.memberRepo.IsMember(ctx, roomID, userID)
+	if err != nil {
+		return 0, err
+	}
+	if !isMember {
+		return 0, ErrNotMember
+	}
+
+	return s.memberRepo.UpdateLastRead(ctx, roomID, userID, messageID)
+}
+
+// GetReaders splits the room members (other than the sender) into who has and hasn't read a message
+func (s *MessageService) GetReaders(ctx context.Context, roomID, msgID, userID uint64) (*models.ReadReceiptResponse, error) {
+	isMember, err := s.memberRepo.IsMember(ctx, roomID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember {
+		return nil, ErrNotMember
+	}
+
+	msg, err := s.messageRepo.GetByID(ctx, msgID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, err
+	}
+	if msg.RoomID != roomID {
+		return nil, ErrMessageNotFound
+	}
+
+	members, err := s.memberRepo.GetByRoomID(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &models.ReadReceiptResponse{
+		MessageID: msgID,
+		ReadBy:    []*models.UserResponse{},
+		UnreadBy:  []*models.UserResponse{},
+	}
+	for _, member := range members {
+		if member.UserID == msg.SenderID {
+			continue
+		}
+		user := s.senderResponse(ctx, member.UserID, nil)
+		if user == nil {
+			continue
+		}
+		if member.HasRead(msgID) {
+			resp.ReadBy = append(resp.ReadBy, user)
+		} else {
+			resp.UnreadBy = append(resp.UnreadBy, user)
+		}
+	}
+	return resp, nil
+}
+
+// Delete soft-deletes a message and returns it as it now appears to clients. Members may
+// delete their own messages; others' need PermissionDeleteOthersMessages. unpinned reports
+// whether the message was pinned; its pin is removed along with it.
+func (s *MessageService) Delete(ctx context.Context, roomID, msgID, userID uint64) (deleted *models.MessageResponse, unpinned bool, err error) {
+	msg, err := s.getRoomMessage(ctx, roomID, msgID)
+	if err != nil {
+		return nil, false, err
 	}
 
+	// Deleting someone else's message needs the permission, not just membership
 	if msg.SenderID != userID {
-		return ErrNotOwner
+		if _, err := requirePermission(ctx, s.memberRepo, roomID, userID, models.PermissionDeleteOthersMessages); err != nil {
+			return nil, false, err
+		}
+	}
+
+	unpinned, err = s.messageRepo.Delete(ctx, msgID)
+	if err != nil {
+		return nil, false, err
 	}
 
-	return s.messageRepo.Delete(ctx, msgID)
+	msg.IsDeleted = true
+	return msg.ToResponse(nil, 0), unpinned, nil
+}
+
+// getRoomMessage loads a live (not deleted) message, making sure it belongs to the room
+func (s *MessageService) getRoomMessage(ctx context.Context, roomID, msgID uint64) (*models.Message, error) {
+	msg, err := s.messageRepo.GetByID(ctx, msgID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, err
+	}
+
+	if msg.RoomID != roomID || msg.IsDeleted {
+		return nil, ErrMessageNotFound
+	}
+	return msg, nil
+}
+
+// toResponses converts messages to responses, resolving senders, reply previews,
+// mentions and reactions as seen by viewerID
+func (s *MessageService) toResponses(ctx context.Context, viewerID uint64, messages []*models.Message) []*models.MessageResponse {
+	// Cache users and parent messages
+	userCache := make(map[uint64]*models.UserResponse)
+	parentCache := make(map[uint64]*models.Message)
+
+	messageIDs := make([]uint64, 0, len(messages))
+	for _, msg := range messages {
+		messageIDs = append(messageIDs, msg.ID)
+	}
+	reactions, err := s.reactionRepo.GetSummaries(ctx, messageIDs, viewerID)
+	if err != nil {
+		log.Printf("[MessageService] Failed to get reactions: %v", err)
+	}
+	mentions, err := s.mentionRepo.GetByMessageIDs(ctx, messageIDs)
+	if err != nil {
+		log.Printf("[MessageService] Failed to get mentions: %v", err)
+	}
+
+	responses := make([]*models.MessageResponse, 0, len(messages))
+	for _, msg := range messages {
+		sender := s.senderResponse(ctx, msg.SenderID, userCache)
+		unreadCount, _ := s.messageRepo.GetUnreadCount(ctx, msg.RoomID, msg.ID, msg.SenderID)
+		resp := msg.ToResponse(sender, unreadCount)
+		resp.Reactions = reactions[msg.ID]
+		if len(mentions[msg.ID]) > 0 {
+			resp.Mentions = s.toMentionResponses(ctx, mentions[msg.ID], userCache)
+		}
+
+		if msg.ParentID.Valid {
+			parentID := uint64(msg.ParentID.Int64)
+			parent, ok := parentCache[parentID]
+			if !ok {
+				parent, _ = s.messageRepo.GetByID(ctx, parentID)
+				parentCache[parentID] = parent
+			}
+			if parent != nil {
+				resp.ReplyTo = parent.ToPreview(s.senderResponse(ctx, parent.SenderID, userCache))
+			}
+		}
+
+		responses = append(responses, resp)
+	}
+	return responses
+}
+
+// senderResponse looks up a user, consulting and filling the cache when one is given
+func (s *MessageService) senderResponse(ctx context.Context, userID uint64, cache map[uint64]*models.UserResponse) *models.UserResponse {
+	if sender, ok := cache[userID]; ok {
+		return sender
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil
+	}
+
+	sender := user.ToResponse()
+	if cache != nil {
+		cache[userID] = sender
+	}
+	return sender
 }
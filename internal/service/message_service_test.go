@@ -0,0 +1,98 @@
+package service
+
+import (
+	"testing"
+
+	"Mmessenger/internal/models"
+)
+
+func messagesWithIDs(ids ...uint64) []*models.Message {
+	messages := make([]*models.Message, 0, len(ids))
+	for _, id := range ids {
+		messages = append(messages, &models.Message{ID: id})
+	}
+	return messages
+}
+
+func messageIDs(messages []*models.Message) []uint64 {
+	ids := make([]uint64, 0, len(messages))
+	for _, msg := range messages {
+		ids = append(ids, msg.ID)
+	}
+	return ids
+}
+
+func equalIDs(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestTrimPage(t *testing.T) {
+	tests := []struct {
+		name      string
+		ids       []uint64
+		limit     int
+		wantOlder []uint64
+		wantNewer []uint64
+		wantMore  bool
+	}{
+		{"empty", nil, 3, []uint64{}, []uint64{}, false},
+		{"under limit", []uint64{1, 2}, 3, []uint64{1, 2}, []uint64{1, 2}, false},
+		{"at limit", []uint64{1, 2, 3}, 3, []uint64{1, 2, 3}, []uint64{1, 2, 3}, false},
+		{"extra row", []uint64{1, 2, 3, 4}, 3, []uint64{2, 3, 4}, []uint64{1, 2, 3}, true},
+		{"zero limit", []uint64{5}, 0, []uint64{}, []uint64{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			older, more := trimOlder(messagesWithIDs(tt.ids...), tt.limit)
+			if !equalIDs(messageIDs(older), tt.wantOlder) || more != tt.wantMore {
+				t.Errorf("trimOlder = %v, %v; want %v, %v", messageIDs(older), more, tt.wantOlder, tt.wantMore)
+			}
+			newer, more := trimNewer(messagesWithIDs(tt.ids...), tt.limit)
+			if !equalIDs(messageIDs(newer), tt.wantNewer) || more != tt.wantMore {
+				t.Errorf("trimNewer = %v, %v; want %v, %v", messageIDs(newer), more, tt.wantNewer, tt.wantMore)
+			}
+		})
+	}
+}
+
+func TestPageCursors(t *testing.T) {
+	tests := []struct {
+		name     string
+		ids      []uint64
+		hasOlder bool
+		hasNewer bool
+		wantNext string
+		wantPrev string
+	}{
+		{"empty page", nil, true, true, "", ""},
+		{"nothing left", []uint64{4, 5}, false, false, "", ""},
+		{"older left", []uint64{4, 5}, true, false, "4", ""},
+		{"newer left", []uint64{4, 5}, false, true, "", "5"},
+		{"both left", []uint64{4, 5, 6}, true, true, "4", "6"},
+	}
+
+	deref := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, prev := pageCursors(messagesWithIDs(tt.ids...), tt.hasOlder, tt.hasNewer)
+			if deref(next) != tt.wantNext || deref(prev) != tt.wantPrev {
+				t.Errorf("pageCursors = %q, %q; want %q, %q", deref(next), deref(prev), tt.wantNext, tt.wantPrev)
+			}
+		})
+	}
+}
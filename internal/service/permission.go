@@ -0,0 +1,32 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"Mmessenger/internal/models"
+	"Mmessenger/internal/repository"
+)
+
+var (
+	ErrPermissionDenied = errors.New("insufficient permission in this room")
+	ErrMemberNotFound   = errors.New("user is not a member of this room")
+	ErrInvalidRole      = errors.New("role must be admin or member")
+)
+
+// requirePermission loads the user's membership and checks that their role grants perm.
+// It returns ErrNotMember for non-members and ErrPermissionDenied when the role falls short.
+func requirePermission(ctx context.Context, memberRepo *repository.RoomMemberRepository, roomID, userID uint64, perm models.Permission) (*models.RoomMember, error) {
+	member, err := memberRepo.GetMember(ctx, roomID, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotMember
+		}
+		return nil, err
+	}
+	if !member.Role.Can(perm) {
+		return nil, ErrPermissionDenied
+	}
+	return member, nil
+}
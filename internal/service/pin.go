@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"Mmessenger/internal/models"
+	"Mmessenger/internal/repository"
+)
+
+var (
+	ErrAlreadyPinned = errors.New("message is already pinned")
+	ErrPinNotFound   = errors.New("message is not pinned")
+)
+
+// PinMessage pins a message of the room for members allowed to pin
+func (s *MessageService) PinMessage(ctx context.Context, roomID, msgID, userID uint64) (*models.PinnedMessageResponse, error) {
+	if _, err := requirePermission(ctx, s.memberRepo, roomID, userID, models.PermissionPin); err != nil {
+		return nil, err
+	}
+
+	msg, err := s.getRoomMessage(ctx, roomID, msgID)
+	if err != nil {
+		return nil, err
+	}
+
+	pin := &models.RoomPin{
+		RoomID:    roomID,
+		MessageID: msgID,
+		PinnedBy:  userID,
+	}
+	if err := s.pinRepo.Create(ctx, pin); err != nil {
+		if errors.Is(err, repository.ErrDuplicatePin) {
+			return nil, ErrAlreadyPinned
+		}
+		return nil, err
+	}
+
+	return s.toPinnedResponses(ctx, userID, []*models.RoomPin{pin}, map[uint64]*models.Message{msg.ID: msg})[0], nil
+}
+
+// UnpinMessage removes a pin from the room for members allowed to pin
+func (s *MessageService) UnpinMessage(ctx context.Context, roomID, msgID, userID uint64) error {
+	if _, err := requirePermission(ctx, s.memberRepo, roomID, userID, models.PermissionPin); err != nil {
+		return err
+	}
+
+	removed, err := s.pinRepo.Delete(ctx, roomID, msgID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrPinNotFound
+	}
+	return nil
+}
+
+// GetPins returns the room's pinned messages, most recently pinned first
+func (s *MessageService) GetPins(ctx context.Context, roomID, userID uint64) ([]*models.PinnedMessageResponse, error) {
+	isMember, err := s.memberRepo.IsMember(ctx, roomID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember {
+		return nil, ErrNotMember
+	}
+
+	pins, err := s.pinRepo.GetByRoomID(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	msgIDs := make([]uint64, len(pins))
+	for i, pin := range pins {
+		msgIDs[i] = pin.MessageID
+	}
+	messages, err := s.messageRepo.GetByIDs(ctx, msgIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.toPinnedResponses(ctx, userID, pins, messages), nil
+}
+
+// toPinnedResponses pairs pins with their messages as seen by viewerID, skipping pins
+// whose message is missing
+func (s *MessageService) toPinnedResponses(ctx context.Context, viewerID uint64, pins []*models.RoomPin, messages map[uint64]*models.Message) []*models.PinnedMessageResponse {
+	pinned := make([]*models.RoomPin, 0, len(pins))
+	msgs := make([]*models.Message, 0, len(pins))
+	for _, pin := range pins {
+		if msg, ok := messages[pin.MessageID]; ok {
+			pinned = append(pinned, pin)
+			msgs = append(msgs, msg)
+		}
+	}
+
+	resp := make([]*models.PinnedMessageResponse, len(pinned))
+	for i, msgResp := range s.toResponses(ctx, viewerID, msgs) {
+		resp[i] = &models.PinnedMessageResponse{
+			Message:  msgResp,
+			PinnedAt: pinned[i].PinnedAt,
+		}
+		if user, err := s.userRepo.GetByID(ctx, pinned[i].PinnedBy); err == nil {
+			resp[i].PinnedBy = user.ToResponse()
+		}
+	}
+	return resp
+}
@@ -0,0 +1,254 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"Mmessenger/internal/config"
+	"Mmessenger/internal/models"
+	"Mmessenger/internal/presence"
+	"Mmessenger/internal/repository"
+)
+
+// maxPresenceLookup bounds the users in one GetPresence call
+const maxPresenceLookup = 100
+
+var ErrTooManyUsers = errors.New("too many users requested")
+
+// PresenceService combines the presence store, which knows the live connections on every
+// server, with users.status, which records the last announced status of each user. A change
+// is reported only by the call that actually changed users.status.
+type PresenceService struct {
+	store      presence.Store
+	userRepo   *repository.UserRepository
+	memberRepo *repository.RoomMemberRepository
+	cfg        *config.PresenceConfig
+}
+
+func NewPresenceService(store presence.Store, userRepo *repository.UserRepository, memberRepo *repository.RoomMemberRepository, cfg *config.PresenceConfig) *PresenceService {
+	return &PresenceService{
+		store:      store,
+		userRepo:   userRepo,
+		memberRepo: memberRepo,
+		cfg:        cfg,
+	}
+}
+
+// IdleTimeout is how long a connection may go without activity before it counts as away
+func (s *PresenceService) IdleTimeout() time.Duration {
+	return s.cfg.IdleTimeout
+}
+
+// Report records that a connection is alive with the given status (online or away) and
+// returns the user's new status if it changed
+func (s *PresenceService) Report(ctx context.Context, userID uint64, connID string, status models.UserStatus) (*models.PresenceChange, error) {
+	if err := s.store.Touch(ctx, userID, connID, status); err != nil {
+		return nil, err
+	}
+	return s.refresh(ctx, userID)
+}
+
+// Disconnect forgets a closed connection and returns the user's new status if it changed
+func (s *PresenceService) Disconnect(ctx context.Context, userID uint64, connID string) (*models.PresenceChange, error) {
+	if err := s.store.Remove(ctx, userID, connID); err != nil {
+		return nil, err
+	}
+	return s.refresh(ctx, userID)
+}
+
+func (s *PresenceService) refresh(ctx context.Context, userID uint64) (*models.PresenceChange, error) {
+	statuses, err := s.store.Statuses(ctx, []uint64{userID})
+	if err != nil {
+		return nil, err
+	}
+	return s.record(ctx, userID, statuses[userID])
+}
+
+// record saves status to users.status, returning the change if there was one
+func (s *PresenceService) record(ctx context.Context, userID uint64, status models.UserStatus) (*models.PresenceChange, error) {
+	changed, err := s.userRepo.SetStatus(ctx, userID, status)
+	if err != nil || !changed {
+		return nil, err
+	}
+	return &models.PresenceChange{UserID: userID, Status: status}, nil
+}
+
+// IsOnline reports whether the user has a live connection on any server
+func (s *PresenceService) IsOnline(ctx context.Context, userID uint64) (bool, error) {
+	status, err := s.Status(ctx, userID)
+	return status != models.UserStatusOffline, err
+}
+
+// Status returns the user's current status across all servers
+func (s *PresenceService) Status(ctx context.Context, userID uint64) (models.UserStatus, error) {
+	statuses, err := s.store.Statuses(ctx, []uint64{userID})
+	if err != nil {
+		return models.UserStatusOffline, err
+	}
+	return statuses[userID], nil
+}
+
+// Announce returns the user's current status if it differs from the last status announced
+// by any server, recording it as announced
+func (s *PresenceService) Announce(ctx context.Context, userID uint64) (*models.PresenceChange, error) {
+	status, err := s.Status(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	changed, err := s.store.Announce(ctx, userID, status)
+	if err != nil || !changed {
+		return nil, err
+	}
+	return &models.PresenceChange{UserID: userID, Status: status}, nil
+}
+
+// Audience returns the users who see the user's status changes: everyone they share a
+// room with who is connected
+func (s *PresenceService) Audience(ctx context.Context, userID uint64) ([]uint64, error) {
+	peerIDs, err := s.memberRepo.GetRoomPeerIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.ConnectedUserIDs(ctx, peerIDs)
+}
+
+// ConnectedUserIDs returns the users among userIDs that have a live connection on any
+// server, whether online or away
+func (s *PresenceService) ConnectedUserIDs(ctx context.Context, userIDs []uint64) ([]uint64, error) {
+	var connected []uint64
+	for start := 0; start < len(userIDs); start += maxPresenceLookup {
+		batch := userIDs[start:min(start+maxPresenceLookup, len(userIDs))]
+		statuses, err := s.store.Statuses(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		for _, userID := range batch {
+			if statuses[userID] != models.UserStatusOffline {
+				connected = append(connected, userID)
+			}
+		}
+	}
+	return connected, nil
+}
+
+// GetPresence returns the current status and last-seen time of each requested user that
+// viewerID may see: the viewer themselves and anyone they share a room with. Other users are
+// left out, the same as users that don't exist.
+func (s *PresenceService) GetPresence(ctx context.Context, viewerID uint64, userIDs []uint64) ([]*models.PresenceResponse, error) {
+	if len(userIDs) > maxPresenceLookup {
+		return nil, ErrTooManyUsers
+	}
+
+	userIDs, err := s.visibleTo(ctx, viewerID, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(userIDs) == 0 {
+		return []*models.PresenceResponse{}, nil
+	}
+
+	lastSeen, err := s.userRepo.GetLastSeen(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := s.store.Statuses(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]*models.PresenceResponse, 0, len(userIDs))
+	for _, userID := range userIDs {
+		seen, ok := lastSeen[userID]
+		if !ok {
+			continue
+		}
+		resp := &models.PresenceResponse{UserID: userID, Status: statuses[userID]}
+		if seen.Valid {
+			resp.LastSeenAt = &seen.Time
+		}
+		responses = append(responses, resp)
+	}
+	return responses, nil
+}
+
+// visibleTo keeps the users whose presence viewerID may see
+func (s *PresenceService) visibleTo(ctx context.Context, viewerID uint64, userIDs []uint64) ([]uint64, error) {
+	peerIDs, err := s.memberRepo.GetRoomPeerIDs(ctx, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	visible := make(map[uint64]bool, len(peerIDs)+1)
+	visible[viewerID] = true
+	for _, peerID := range peerIDs {
+		visible[peerID] = true
+	}
+
+	var allowed []uint64
+	for _, userID := range userIDs {
+		if visible[userID] {
+			allowed = append(allowed, userID)
+		}
+	}
+	return allowed, nil
+}
+
+// Sweep brings users.status in line with the store for every user recorded as online or
+// away, which catches users whose server stopped without disconnecting them. It returns
+// the changes to announce.
+func (s *PresenceService) Sweep(ctx context.Context) ([]*models.PresenceChange, error) {
+	recorded, err := s.userRepo.GetActiveStatuses(ctx)
+	if err != nil {
+		return nil, err
+	}
+	userIDs := make([]uint64, 0, len(recorded))
+	for userID := range recorded {
+		userIDs = append(userIDs, userID)
+	}
+
+	var changes []*models.PresenceChange
+	for start := 0; start < len(userIDs); start += maxPresenceLookup {
+		batch := userIDs[start:min(start+maxPresenceLookup, len(userIDs))]
+		statuses, err := s.store.Statuses(ctx, batch)
+		if err != nil {
+			return changes, err
+		}
+
+		for _, userID := range batch {
+			if statuses[userID] == recorded[userID] {
+				continue
+			}
+			change, err := s.record(ctx, userID, statuses[userID])
+			if err != nil {
+				log.Printf("[PresenceService] Failed to update status of user %d: %v", userID, err)
+				continue
+			}
+			if change != nil {
+				changes = append(changes, change)
+			}
+		}
+	}
+	return changes, nil
+}
+
+// RunSweeper sweeps every interval until ctx is done, passing the changes to announce
+func (s *PresenceService) RunSweeper(ctx context.Context, interval time.Duration, announce func(*models.PresenceChange)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changes, err := s.Sweep(ctx)
+			if err != nil {
+				log.Printf("[PresenceService] Failed to sweep presence: %v", err)
+			}
+			for _, change := range changes {
+				announce(change)
+			}
+		}
+	}
+}
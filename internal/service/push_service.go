@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"log"
+	"time"
 
 	"github.com/SherClockHolmes/webpush-go"
 
@@ -81,15 +82,13 @@ func (s *PushService) SendToUser(ctx context.Context, userID uint64, notificatio
 	return nil
 }
 
-// SendToRoomMembers sends a push notification to all members of a room except the sender
-func (s *PushService) SendToRoomMembers(ctx context.Context, roomID, senderID uint64, notification *models.PushNotification) error {
+// SendToRoomMembers sends a push notification about a new message to the members of a room
+// who want it: the sender, members who muted the room and members whose notification level
+// isn't "all" are skipped, except that mentionedUserIDs are notified through a mute and at the
+// "mentions" level. Members who archived the room get it back unless they are skipped.
+func (s *PushService) SendToRoomMembers(ctx context.Context, roomID, senderID uint64, mentionedUserIDs []uint64, notification *models.PushNotification) error {
 	log.Printf("[Push] SendToRoomMembers called - roomID: %d, senderID: %d", roomID, senderID)
 
-	if !s.IsConfigured() {
-		log.Println("[Push] VAPID not configured, skipping push")
-		return nil
-	}
-
 	// Get room members
 	members, err := s.memberRepo.GetByRoomID(ctx, roomID)
 	if err != nil {
@@ -98,14 +97,40 @@ func (s *PushService) SendToRoomMembers(ctx context.Context, roomID, senderID ui
 	}
 	log.Printf("[Push] Found %d members in room", len(members))
 
-	// Collect user IDs excluding sender
-	var userIDs []uint64
+	// Collect user IDs excluding sender and members who don't want to be notified
+	mentioned := make(map[uint64]bool, len(mentionedUserIDs))
+	for _, userID := range mentionedUserIDs {
+		mentioned[userID] = true
+	}
+
+	now := time.Now()
+	var userIDs, stayArchived []uint64
+	hasArchived := false
 	for _, member := range members {
-		if member.UserID != senderID {
-			userIDs = append(userIDs, member.UserID)
+		if member.UserID == senderID {
+			continue
+		}
+		if !wantsNotification(member, now, mentioned[member.UserID]) {
+			if member.Archived {
+				stayArchived = append(stayArchived, member.UserID)
+			}
+			continue
+		}
+		hasArchived = hasArchived || member.Archived
+		userIDs = append(userIDs, member.UserID)
+	}
+
+	if hasArchived {
+		if err := s.memberRepo.Unarchive(ctx, roomID, stayArchived); err != nil {
+			log.Printf("[Push] Failed to unarchive room %d: %v", roomID, err)
 		}
 	}
 
+	if !s.IsConfigured() {
+		log.Println("[Push] VAPID not configured, skipping push")
+		return nil
+	}
+
 	if len(userIDs) == 0 {
 		log.Println("[Push] No other members to notify")
 		return nil
@@ -136,6 +161,15 @@ func (s *PushService) SendToRoomMembers(ctx context.Context, roomID, senderID ui
 	return nil
 }
 
+// wantsNotification reports whether a new message in the room should notify the member.
+// A mention gets through a mute; only the "none" level silences it.
+func wantsNotification(member *models.RoomMember, now time.Time, mentioned bool) bool {
+	if mentioned {
+		return member.NotificationLevel != models.NotificationLevelNone
+	}
+	return !member.IsMuted(now) && member.NotificationLevel == models.NotificationLevelAll
+}
+
 // sendNotification sends a push notification to a single subscription
 func (s *PushService) sendNotification(sub *models.PushSubscription, notification *models.PushNotification) error {
 	payload, err := json.Marshal(notification)
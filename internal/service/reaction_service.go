@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"Mmessenger/internal/models"
+	"Mmessenger/internal/repository"
+)
+
+// maxEmojiLength limits the emoji column (VARCHAR(64)) in characters
+const maxEmojiLength = 64
+
+// shortcodePattern matches emoji shortcodes such as :thumbsup: or :+1:
+var shortcodePattern = regexp.MustCompile(`^:[a-z0-9_+-]+:$`)
+
+var (
+	ErrInvalidEmoji = errors.New("invalid emoji")
+)
+
+type ReactionService struct {
+	reactionRepo *repository.ReactionRepository
+	messageRepo  *repository.MessageRepository
+	memberRepo   *repository.RoomMemberRepository
+}
+
+func NewReactionService(reactionRepo *repository.ReactionRepository, messageRepo *repository.MessageRepository, memberRepo *repository.RoomMemberRepository) *ReactionService {
+	return &ReactionService{
+		reactionRepo: reactionRepo,
+		messageRepo:  messageRepo,
+		memberRepo:   memberRepo,
+	}
+}
+
+// Add reacts to a message with an emoji and returns the resulting update. added is false
+// when the user had already reacted with that emoji, so there is nothing to broadcast.
+func (s *ReactionService) Add(ctx context.Context, roomID, msgID, userID uint64, emoji string) (update *models.ReactionUpdate, added bool, err error) {
+	emoji, err = s.validate(ctx, roomID, msgID, userID, emoji)
+	if err != nil {
+		return nil, false, err
+	}
+
+	reaction := &models.MessageReaction{
+		MessageID: msgID,
+		UserID:    userID,
+		Emoji:     emoji,
+	}
+	if added, err = s.reactionRepo.Add(ctx, reaction); err != nil {
+		return nil, false, err
+	}
+
+	update, err = s.update(ctx, roomID, msgID, userID, emoji, models.ReactionActionAdded)
+	return update, added, err
+}
+
+// Remove withdraws the user's emoji reaction and returns the resulting update. removed is
+// false when there was no such reaction, so there is nothing to broadcast.
+func (s *ReactionService) Remove(ctx context.Context, roomID, msgID, userID uint64, emoji string) (update *models.ReactionUpdate, removed bool, err error) {
+	emoji, err = s.validate(ctx, roomID, msgID, userID, emoji)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if removed, err = s.reactionRepo.Remove(ctx, msgID, userID, emoji); err != nil {
+		return nil, false, err
+	}
+
+	update, err = s.update(ctx, roomID, msgID, userID, emoji, models.ReactionActionRemoved)
+	return update, removed, err
+}
+
+func (s *ReactionService) validate(ctx context.Context, roomID, msgID, userID uint64, emoji string) (string, error) {
+	emoji = strings.TrimSpace(emoji)
+	if !validEmoji(emoji) {
+		return "", ErrInvalidEmoji
+	}
+
+	isMember, err := s.memberRepo.IsMember(ctx, roomID, userID)
+	if err != nil {
+		return "", err
+	}
+	if !isMember {
+		return "", ErrNotMember
+	}
+
+	msg, err := s.messageRepo.GetByID(ctx, msgID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrMessageNotFound
+		}
+		return "", err
+	}
+	if msg.RoomID != roomID || msg.IsDeleted {
+		return "", ErrMessageNotFound
+	}
+
+	return emoji, nil
+}
+
+// validEmoji reports whether s is an emoji shortcode or a single run of emoji characters,
+// including skin tone modifiers, presentation selectors, ZWJ sequences, flags and keycaps
+func validEmoji(s string) bool {
+	if s == "" || utf8.RuneCountInString(s) > maxEmojiLength {
+		return false
+	}
+	if shortcodePattern.MatchString(s) {
+		return true
+	}
+
+	keycap := strings.ContainsRune(s, '\u20E3')
+	hasEmoji := false
+	for _, r := range s {
+		switch {
+		case r == '\u200D', r == '\uFE0F', r == '\u20E3':
+			// Zero width joiner, emoji presentation selector, combining keycap
+		case r >= 0x1F3FB && r <= 0x1F3FF, r >= 0xE0020 && r <= 0xE007F:
+			// Skin tone modifiers and the tags of subdivision flags
+		case keycap && (r == '#' || r == '*' || (r >= '0' && r <= '9')):
+			hasEmoji = true
+		case unicode.Is(unicode.So, r):
+			// Pictographs, including the regional indicators that make up flags
+			hasEmoji = true
+		default:
+			return false
+		}
+	}
+	return hasEmoji
+}
+
+func (s *ReactionService) update(ctx context.Context, roomID, msgID, userID uint64, emoji string, action models.ReactionAction) (*models.ReactionUpdate, error) {
+	// The update is broadcast to everyone, so counts are computed without a viewer
+	summaries, err := s.reactionRepo.GetSummaries(ctx, []uint64{msgID}, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	reactions := summaries[msgID]
+	if reactions == nil {
+		reactions = []*models.ReactionSummary{}
+	}
+
+	return &models.ReactionUpdate{
+		RoomID:    roomID,
+		MessageID: msgID,
+		UserID:    userID,
+		Emoji:     emoji,
+		Action:    action,
+		Reactions: reactions,
+	}, nil
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidEmoji(t *testing.T) {
+	tests := []struct {
+		name  string
+		emoji string
+		want  bool
+	}{
+		{"single emoji", "👍", true},
+		{"skin tone", "👍🏽", true},
+		{"zwj sequence", "👨‍👩‍👧", true},
+		{"presentation selector", "❤️", true},
+		{"flag", "🇰🇷", true},
+		{"keycap", "1️⃣", true},
+		{"shortcode", ":thumbsup:", true},
+		{"shortcode with plus", ":+1:", true},
+		{"empty", "", false},
+		{"plain text", "abc", false},
+		{"digit without keycap", "1", false},
+		{"emoji with text", "hi 👍", false},
+		{"markup", "<b>👍</b>", false},
+		{"uppercase shortcode", ":ThumbsUp:", false},
+		{"shortcode with space", ":thumbs up:", false},
+		{"empty shortcode", "::", false},
+		{"too long", strings.Repeat("👍", maxEmojiLength+1), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validEmoji(tt.emoji); got != tt.want {
+				t.Errorf("validEmoji(%q) = %v, want %v", tt.emoji, got, tt.want)
+			}
+		})
+	}
+}
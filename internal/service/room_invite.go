@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"Mmessenger/internal/models"
+	"Mmessenger/internal/repository"
+)
+
+var (
+	ErrInviteNotFound       = errors.New("invite not found")
+	ErrInviteExpired        = errors.New("invite has expired")
+	ErrInviteExhausted      = errors.New("invite has reached its maximum uses")
+	ErrInvalidInviteOptions = errors.New("max uses and expiry must be positive")
+	ErrAlreadyMember        = errors.New("already a member of this room")
+)
+
+// inviteTokenBytes is the amount of randomness in an invite token
+const inviteTokenBytes = 18
+
+func newInviteToken() (string, error) {
+	b := make([]byte, inviteTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CreateInvite creates a shareable invite to the room. Members who may invite can create
+// member invites; admin invites need the right to manage roles.
+func (s *RoomService) CreateInvite(ctx context.Context, roomID, userID uint64, req *models.CreateInviteRequest) (*models.RoomInviteResponse, error) {
+	creator, err := requirePermission(ctx, s.memberRepo, roomID, userID, models.PermissionInvite)
+	if err != nil {
+		return nil, err
+	}
+
+	room, err := s.roomRepo.GetByID(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if room.IsDirect() {
+		return nil, ErrDirectRoomMembers
+	}
+
+	role := req.Role
+	if role == "" {
+		role = models.MemberRoleMember
+	}
+	switch role {
+	case models.MemberRoleMember:
+	case models.MemberRoleAdmin:
+		if !creator.Role.Can(models.PermissionManageRoles) {
+			return nil, ErrPermissionDenied
+		}
+	default:
+		return nil, ErrInvalidRole
+	}
+
+	token, err := newInviteToken()
+	if err != nil {
+		return nil, err
+	}
+
+	invite := &models.RoomInvite{
+		RoomID:    roomID,
+		Token:     token,
+		CreatedBy: userID,
+		Role:      role,
+		CreatedAt: time.Now(),
+	}
+	if req.MaxUses != nil {
+		if *req.MaxUses <= 0 {
+			return nil, ErrInvalidInviteOptions
+		}
+		invite.MaxUses = sql.NullInt64{Int64: *req.MaxUses, Valid: true}
+	}
+	if req.ExpiresInSeconds != nil {
+		if *req.ExpiresInSeconds <= 0 {
+			return nil, ErrInvalidInviteOptions
+		}
+		expiresAt := time.Now().Add(time.Duration(*req.ExpiresInSeconds) * time.Second)
+		invite.ExpiresAt = sql.NullTime{Time: expiresAt, Valid: true}
+	}
+
+	if err := s.inviteRepo.Create(ctx, invite); err != nil {
+		return nil, err
+	}
+	return invite.ToResponse(), nil
+}
+
+// ListInvites returns the room's invites that have not been revoked
+func (s *RoomService) ListInvites(ctx context.Context, roomID, userID uint64) ([]*models.RoomInviteResponse, error) {
+	if _, err := requirePermission(ctx, s.memberRepo, roomID, userID, models.PermissionInvite); err != nil {
+		return nil, err
+	}
+
+	invites, err := s.inviteRepo.GetByRoomID(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make([]*models.RoomInviteResponse, len(invites))
+	for i, invite := range invites {
+		resp[i] = invite.ToResponse()
+	}
+	return resp, nil
+}
+
+// RevokeInvite disables an invite of the room
+func (s *RoomService) RevokeInvite(ctx context.Context, roomID, inviteID, userID uint64) error {
+	if _, err := requirePermission(ctx, s.memberRepo, roomID, userID, models.PermissionInvite); err != nil {
+		return err
+	}
+
+	invite, err := s.inviteRepo.GetByID(ctx, inviteID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInviteNotFound
+		}
+		return err
+	}
+	if invite.RoomID != roomID || invite.RevokedAt.Valid {
+		return ErrInviteNotFound
+	}
+
+	return s.inviteRepo.Revoke(ctx, inviteID)
+}
+
+// AcceptInvite adds the user to the invite's room with the invite's role. The membership
+// records which invite was used, and a system message naming the inviter is written.
+func (s *RoomService) AcceptInvite(ctx context.Context, token string, userID uint64) (*models.RoomJoin, error) {
+	invite, err := s.inviteRepo.GetByToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInviteNotFound
+		}
+		return nil, err
+	}
+	if invite.RevokedAt.Valid {
+		return nil, ErrInviteNotFound
+	}
+	if invite.IsExpired(time.Now()) {
+		return nil, ErrInviteExpired
+	}
+
+	isMember, err := s.memberRepo.IsMember(ctx, invite.RoomID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if isMember {
+		return nil, ErrAlreadyMember
+	}
+	if invite.IsExhausted() {
+		return nil, ErrInviteExhausted
+	}
+
+	member, err := s.inviteRepo.Redeem(ctx, invite, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrInviteUnavailable) {
+			// Lost a race with another accept, the expiry or a revoke
+			return nil, ErrInviteExhausted
+		}
+		return nil, memberAddError(err)
+	}
+
+	room, err := s.roomRepo.GetByID(ctx, invite.RoomID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.completeJoin(ctx, room, member, &models.SystemMessageMetadata{
+		Action:   models.SystemActionMemberJoined,
+		Target:   s.systemUser(ctx, invite.CreatedBy),
+		InviteID: &invite.ID,
+	}), nil
+}
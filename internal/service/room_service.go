@@ -3,40 +3,94 @@ package service
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
 
+	"Mmessenger/internal/config"
 	"Mmessenger/internal/models"
 	"Mmessenger/internal/repository"
 )
 
 var (
-	ErrNotMember        = errors.New("not a member of this room")
-	ErrNotOwner         = errors.New("not the owner of this room")
-	ErrOwnerCannotLeave = errors.New("owner cannot leave the room")
+	ErrNotMember         = errors.New("not a member of this room")
+	ErrNotOwner          = errors.New("not the owner of this room")
+	ErrOwnerCannotLeave  = errors.New("owner cannot leave the room")
+	ErrInvalidEditWindow = errors.New("edit window must not be negative")
+	ErrInvalidRoomType   = errors.New("invalid room type")
+	ErrDirectRoomMembers = errors.New("direct message rooms have exactly two members")
+	ErrInvalidDirectPeer = errors.New("cannot start a direct message with yourself")
+
+	ErrInvalidTransferTarget = errors.New("ownership must be transferred to another member")
+	ErrOwnershipChanged      = errors.New("room ownership changed during the transfer")
+
+	ErrRoomFull             = errors.New("room has reached its member limit")
+	ErrInvalidCapacity      = errors.New("max members is outside the allowed range")
+	ErrCapacityBelowMembers = errors.New("room already has more members than the new limit")
+	ErrDuplicateInvitee     = errors.New("the same user is invited more than once")
+
+	ErrRoomNotFound      = errors.New("room not found")
+	ErrRoomNotPublic     = errors.New("room is not public")
+	ErrInvalidVisibility = errors.New("visibility must be public or private")
+
+	ErrInvalidNotificationLevel = errors.New("notification level must be all, mentions or none")
+	ErrInvalidMuteDuration      = errors.New("mute duration must not be negative")
 )
 
+// minRoomCapacity keeps room for the owner and at least one other member
+const minRoomCapacity = 2
+
 type RoomService struct {
 	roomRepo    *repository.RoomRepository
 	memberRepo  *repository.RoomMemberRepository
 	userRepo    *repository.UserRepository
 	messageRepo *repository.MessageRepository
+	inviteRepo  *repository.RoomInviteRepository
+	cfg         *config.RoomConfig
 }
 
-func NewRoomService(roomRepo *repository.RoomRepository, memberRepo *repository.RoomMemberRepository, userRepo *repository.UserRepository, messageRepo *repository.MessageRepository) *RoomService {
+func NewRoomService(roomRepo *repository.RoomRepository, memberRepo *repository.RoomMemberRepository, userRepo *repository.UserRepository, messageRepo *repository.MessageRepository, inviteRepo *repository.RoomInviteRepository, cfg *config.RoomConfig) *RoomService {
 	return &RoomService{
 		roomRepo:    roomRepo,
 		memberRepo:  memberRepo,
 		userRepo:    userRepo,
 		messageRepo: messageRepo,
+		inviteRepo:  inviteRepo,
+		cfg:         cfg,
 	}
 }
 
+// Create creates a group room; direct message rooms are opened with GetOrCreateDirect
 func (s *RoomService) Create(ctx context.Context, ownerID uint64, req *models.CreateRoomRequest) (*models.RoomResponse, error) {
+	if req.RoomType != "" && req.RoomType != models.RoomTypeGroup {
+		return nil, ErrInvalidRoomType
+	}
+
+	visibility := req.Visibility
+	if visibility == "" {
+		visibility = models.RoomVisibilityPrivate
+	}
+	if !validVisibility(visibility) {
+		return nil, ErrInvalidVisibility
+	}
+
 	room := &models.Room{
 		Name:       req.Name,
 		RoomType:   req.RoomType,
+		Visibility: visibility,
 		OwnerID:    ownerID,
-		MaxMembers: 100,
+		MaxMembers: s.cfg.DefaultMaxMembers,
+	}
+
+	memberIDs, err := s.validateInvitees(ctx, ownerID, req.MemberIDs)
+	if err != nil {
+		return nil, err
+	}
+	if 1+len(memberIDs) > room.MaxMembers {
+		return nil, ErrRoomFull
 	}
 
 	if req.Description != "" {
@@ -47,35 +101,139 @@ func (s *RoomService) Create(ctx context.Context, ownerID uint64, req *models.Cr
 		room.RoomType = models.RoomTypeGroup
 	}
 
-	if err := s.roomRepo.Create(ctx, room); err != nil {
-		return nil, err
+	// The owner joins first, then the invitees
+	members := []*models.RoomMember{
+		{UserID: ownerID, Role: models.MemberRoleOwner},
+	}
+	for _, userID := range memberIDs {
+		members = append(members, &models.RoomMember{UserID: userID, Role: models.MemberRoleMember})
+	}
+	if err := s.roomRepo.Create(ctx, room, members); err != nil {
+		return nil, memberAddError(err)
 	}
 
-	// Add owner as member
-	member := &models.RoomMember{
-		RoomID: room.ID,
-		UserID: ownerID,
-		Role:   models.MemberRoleOwner,
+	resp := room.ToResponse()
+	resp.MemberCount = 1 + len(memberIDs)
+	return resp, nil
+}
+
+// validateInvitees checks that every user invited at room creation exists and is listed
+// once. The owner is dropped from the list since they join as owner anyway.
+func (s *RoomService) validateInvitees(ctx context.Context, ownerID uint64, userIDs []uint64) ([]uint64, error) {
+	seen := make(map[uint64]bool, len(userIDs))
+	var memberIDs []uint64
+	for _, userID := range userIDs {
+		if userID == ownerID {
+			continue
+		}
+		if seen[userID] {
+			return nil, ErrDuplicateInvitee
+		}
+		seen[userID] = true
+
+		if err := s.requireUser(ctx, userID); err != nil {
+			return nil, err
+		}
+		memberIDs = append(memberIDs, userID)
 	}
-	if err := s.memberRepo.Add(ctx, member); err != nil {
-		return nil, err
+	return memberIDs, nil
+}
+
+// requireUser returns ErrUserNotFound unless the user exists
+func (s *RoomService) requireUser(ctx context.Context, userID uint64) error {
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return err
 	}
+	return nil
+}
+
+// memberAddError translates RoomMemberRepository.Add failures into service errors
+func memberAddError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrRoomFull):
+		return ErrRoomFull
+	case errors.Is(err, repository.ErrDuplicateMember):
+		return ErrAlreadyMember
+	}
+	return err
+}
 
-	// Add other members if specified
-	for _, userID := range req.MemberIDs {
-		if userID != ownerID {
-			m := &models.RoomMember{
-				RoomID: room.ID,
-				UserID: userID,
-				Role:   models.MemberRoleMember,
+// GetOrCreateDirect returns the direct message room between userID and peerID, creating it if needed.
+// created reports whether a new room was made.
+func (s *RoomService) GetOrCreateDirect(ctx context.Context, userID, peerID uint64) (resp *models.RoomResponse, created bool, err error) {
+	if peerID == userID {
+		return nil, false, ErrInvalidDirectPeer
+	}
+	if err := s.requireUser(ctx, peerID); err != nil {
+		return nil, false, err
+	}
+
+	dmKey := models.DirectRoomKey(userID, peerID)
+	room, err := s.roomRepo.GetByDMKey(ctx, dmKey)
+	if err == nil {
+		return s.toResponse(ctx, room, userID), false, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, err
+	}
+
+	room = &models.Room{
+		RoomType:   models.RoomTypePrivate,
+		Visibility: models.RoomVisibilityPrivate,
+		DMKey:      sql.NullString{String: dmKey, Valid: true},
+		OwnerID:    userID,
+		MaxMembers: 2,
+	}
+	members := []*models.RoomMember{
+		{UserID: userID, Role: models.MemberRoleOwner},
+		{UserID: peerID, Role: models.MemberRoleMember},
+	}
+	if err := s.roomRepo.Create(ctx, room, members); err != nil {
+		if errors.Is(err, repository.ErrDuplicateDirectRoom) {
+			// Opened concurrently by the other participant
+			room, err = s.roomRepo.GetByDMKey(ctx, dmKey)
+			if err != nil {
+				return nil, false, err
 			}
-			s.memberRepo.Add(ctx, m)
+			return s.toResponse(ctx, room, userID), false, nil
 		}
+		return nil, false, err
 	}
 
+	return s.toResponse(ctx, room, userID), true, nil
+}
+
+// toResponse converts a room as seen by viewerID. Direct message rooms take their
+// name and avatar from the other participant.
+func (s *RoomService) toResponse(ctx context.Context, room *models.Room, viewerID uint64) *models.RoomResponse {
 	resp := room.ToResponse()
-	resp.MemberCount = 1 + len(req.MemberIDs)
-	return resp, nil
+	resp.MemberCount, _ = s.roomRepo.GetMemberCount(ctx, room.ID)
+
+	if !room.IsDirect() {
+		return resp
+	}
+
+	memberIDs, err := s.memberRepo.GetUserIDsByRoomID(ctx, room.ID)
+	if err != nil {
+		return resp
+	}
+	for _, memberID := range memberIDs {
+		if memberID == viewerID {
+			continue
+		}
+		peer, err := s.userRepo.GetByID(ctx, memberID)
+		if err != nil {
+			break
+		}
+		resp.DirectPeer = peer.ToResponse()
+		resp.Name = peer.Username
+		resp.AvatarURL = resp.DirectPeer.AvatarURL
+		break
+	}
+	return resp
 }
 
 func (s *RoomService) GetByID(ctx context.Context, roomID, userID uint64) (*models.RoomResponse, error) {
@@ -92,66 +250,263 @@ func (s *RoomService) GetByID(ctx context.Context, roomID, userID uint64) (*mode
 		return nil, err
 	}
 
-	count, _ := s.roomRepo.GetMemberCount(ctx, roomID)
-	resp := room.ToResponse()
-	resp.MemberCount = count
-	return resp, nil
+	return s.toResponse(ctx, room, userID), nil
 }
 
-func (s *RoomService) GetByUserID(ctx context.Context, userID uint64) ([]*models.RoomResponse, error) {
+// GetByUserID lists the user's rooms, with direct messages separate from group rooms
+func (s *RoomService) GetByUserID(ctx context.Context, userID uint64) (*models.RoomListResponse, error) {
 	rooms, err := s.roomRepo.GetByUserID(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	// Get unread counts for all rooms at once
+	// Get unread counts and the user's settings for all rooms at once
 	unreadCounts, _ := s.messageRepo.GetUnreadCountsForUser(ctx, userID)
+	memberships, _ := s.memberRepo.GetByUserID(ctx, userID)
 
-	var responses []*models.RoomResponse
+	list := &models.RoomListResponse{
+		Rooms:          []*models.RoomResponse{},
+		DirectMessages: []*models.RoomResponse{},
+	}
 	for _, room := range rooms {
-		resp := room.ToResponse()
-		count, _ := s.roomRepo.GetMemberCount(ctx, room.ID)
-		resp.MemberCount = count
+		resp := s.toResponse(ctx, room, userID)
 		if unreadCounts != nil {
 			resp.UnreadCount = unreadCounts[room.ID]
 		}
-		responses = append(responses, resp)
+		if member, ok := memberships[room.ID]; ok {
+			resp.Settings = member.Settings()
+		}
+		if room.IsDirect() {
+			list.DirectMessages = append(list.DirectMessages, resp)
+		} else {
+			list.Rooms = append(list.Rooms, resp)
+		}
 	}
-	return responses, nil
+	return list, nil
 }
 
-func (s *RoomService) Update(ctx context.Context, roomID, userID uint64, req *models.UpdateRoomRequest) (*models.RoomResponse, error) {
-	room, err := s.roomRepo.GetByID(ctx, roomID)
+// GetSettings returns the user's personal settings for the room
+func (s *RoomService) GetSettings(ctx context.Context, roomID, userID uint64) (*models.RoomSettings, error) {
+	member, err := s.memberRepo.GetMember(ctx, roomID, userID)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotMember
+		}
+		return nil, err
+	}
+	return member.Settings(), nil
+}
+
+// UpdateSettings changes the user's personal mute, archive and notification settings for the room
+func (s *RoomService) UpdateSettings(ctx context.Context, roomID, userID uint64, req *models.UpdateRoomSettingsRequest) (*models.RoomSettings, error) {
+	member, err := s.memberRepo.GetMember(ctx, roomID, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotMember
+		}
+		return nil, err
+	}
+
+	if req.MuteForSeconds != nil {
+		switch {
+		case *req.MuteForSeconds < 0:
+			return nil, ErrInvalidMuteDuration
+		case *req.MuteForSeconds == 0:
+			member.MutedUntil = sql.NullTime{}
+		default:
+			mutedUntil := time.Now().Add(time.Duration(*req.MuteForSeconds) * time.Second)
+			member.MutedUntil = sql.NullTime{Time: mutedUntil, Valid: true}
+		}
+	}
+	if req.Archived != nil {
+		member.Archived = *req.Archived
+	}
+	if req.NotificationLevel != nil {
+		switch *req.NotificationLevel {
+		case models.NotificationLevelAll, models.NotificationLevelMentions, models.NotificationLevelNone:
+			member.NotificationLevel = *req.NotificationLevel
+		default:
+			return nil, ErrInvalidNotificationLevel
+		}
+	}
+
+	if err := s.memberRepo.UpdateSettings(ctx, member); err != nil {
 		return nil, err
 	}
+	return member.Settings(), nil
+}
 
-	if room.OwnerID != userID {
-		return nil, ErrNotOwner
+// Update changes room settings and returns the system messages recording a rename or
+// description change
+func (s *RoomService) Update(ctx context.Context, roomID, userID uint64, req *models.UpdateRoomRequest) (*models.RoomResponse, []*models.MessageResponse, error) {
+	member, err := requirePermission(ctx, s.memberRepo, roomID, userID, models.PermissionEditRoom)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if req.Name != nil {
+	room, err := s.roomRepo.GetByID(ctx, roomID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Every field is validated before anything is saved, so a rejected request changes nothing
+	if req.MaxMembers != nil && *req.MaxMembers != room.MaxMembers {
+		if err := s.validateMaxMembers(room, member, *req.MaxMembers); err != nil {
+			return nil, nil, err
+		}
+		room.MaxMembers = *req.MaxMembers
+	}
+
+	var changes []*models.SystemMessageMetadata
+	if req.Name != nil && *req.Name != room.Name {
+		oldName := room.Name
+		changes = append(changes, &models.SystemMessageMetadata{
+			Action:   models.SystemActionRoomRenamed,
+			OldValue: &oldName,
+			NewValue: req.Name,
+		})
 		room.Name = *req.Name
 	}
-	if req.Description != nil {
+	if req.Description != nil && *req.Description != room.Description.String {
+		oldDescription := room.Description.String
+		changes = append(changes, &models.SystemMessageMetadata{
+			Action:   models.SystemActionDescriptionChanged,
+			OldValue: &oldDescription,
+			NewValue: req.Description,
+		})
 		room.Description = sql.NullString{String: *req.Description, Valid: true}
 	}
+	if req.Visibility != nil {
+		if !validVisibility(*req.Visibility) || (room.IsDirect() && *req.Visibility != models.RoomVisibilityPrivate) {
+			return nil, nil, ErrInvalidVisibility
+		}
+		room.Visibility = *req.Visibility
+	}
+	if req.EditWindowSeconds != nil {
+		switch {
+		case *req.EditWindowSeconds < 0:
+			return nil, nil, ErrInvalidEditWindow
+		case *req.EditWindowSeconds == 0:
+			room.EditWindowSeconds = sql.NullInt64{}
+		default:
+			room.EditWindowSeconds = sql.NullInt64{Int64: *req.EditWindowSeconds, Valid: true}
+		}
+	}
 
 	if err := s.roomRepo.Update(ctx, room); err != nil {
+		if errors.Is(err, repository.ErrRoomFull) {
+			return nil, nil, ErrCapacityBelowMembers
+		}
+		return nil, nil, err
+	}
+
+	var systemMessages []*models.MessageResponse
+	for _, change := range changes {
+		if msg := s.postSystemMessage(ctx, roomID, userID, change); msg != nil {
+			systemMessages = append(systemMessages, msg)
+		}
+	}
+	return s.toResponse(ctx, room, userID), systemMessages, nil
+}
+
+func validVisibility(v models.RoomVisibility) bool {
+	return v == models.RoomVisibilityPrivate || v == models.RoomVisibilityPublic
+}
+
+// Discover lists public rooms for the directory, marking the ones userID already belongs to
+func (s *RoomService) Discover(ctx context.Context, userID uint64, filter *models.RoomDirectoryFilter) (*models.RoomDirectoryResponse, error) {
+	// Fetch one extra row to know whether another page exists
+	limit := filter.Limit
+	filter.Limit = limit + 1
+	entries, err := s.roomRepo.SearchPublic(ctx, userID, filter)
+	if err != nil {
 		return nil, err
 	}
 
-	return room.ToResponse(), nil
+	resp := &models.RoomDirectoryResponse{
+		Rooms:   []*models.RoomDirectoryResult{},
+		HasMore: len(entries) > limit,
+	}
+	if resp.HasMore {
+		entries = entries[:limit]
+		cursor := strconv.FormatUint(entries[len(entries)-1].Room.ID, 10)
+		resp.NextCursor = &cursor
+	}
+
+	for _, entry := range entries {
+		room := entry.Room.ToResponse()
+		room.MemberCount = entry.MemberCount
+		resp.Rooms = append(resp.Rooms, &models.RoomDirectoryResult{
+			Room:     room,
+			IsMember: entry.IsMember,
+		})
+	}
+	return resp, nil
 }
 
-func (s *RoomService) Delete(ctx context.Context, roomID, userID uint64) error {
+// JoinPublic adds the user to a public room as a member
+func (s *RoomService) JoinPublic(ctx context.Context, roomID, userID uint64) (*models.RoomJoin, error) {
 	room, err := s.roomRepo.GetByID(ctx, roomID)
 	if err != nil {
-		return err
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRoomNotFound
+		}
+		return nil, err
+	}
+	if room.Visibility != models.RoomVisibilityPublic {
+		return nil, ErrRoomNotPublic
 	}
 
-	if room.OwnerID != userID {
-		return ErrNotOwner
+	isMember, err := s.memberRepo.IsMember(ctx, roomID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if isMember {
+		return nil, ErrAlreadyMember
+	}
+
+	member := &models.RoomMember{
+		RoomID: roomID,
+		UserID: userID,
+		Role:   models.MemberRoleMember,
+	}
+	if err := s.memberRepo.Add(ctx, member); err != nil {
+		return nil, memberAddError(err)
+	}
+
+	return s.completeJoin(ctx, room, member, &models.SystemMessageMetadata{
+		Action: models.SystemActionMemberJoined,
+	}), nil
+}
+
+// completeJoin writes the system message for a user who joined by themselves and
+// describes the join for broadcasting
+func (s *RoomService) completeJoin(ctx context.Context, room *models.Room, member *models.RoomMember, metadata *models.SystemMessageMetadata) *models.RoomJoin {
+	return &models.RoomJoin{
+		Room:          s.toResponse(ctx, room, member.UserID),
+		Role:          member.Role,
+		SystemMessage: s.postSystemMessage(ctx, room.ID, member.UserID, metadata),
+	}
+}
+
+// validateMaxMembers checks a new room capacity against the server-wide limit; only the owner
+// may change it
+func (s *RoomService) validateMaxMembers(room *models.Room, member *models.RoomMember, maxMembers int) error {
+	if !member.Role.Can(models.PermissionSetCapacity) {
+		return ErrPermissionDenied
+	}
+	if room.IsDirect() {
+		return ErrDirectRoomMembers
+	}
+	if maxMembers < minRoomCapacity || maxMembers > s.cfg.MaxMembersLimit {
+		return ErrInvalidCapacity
+	}
+	return nil
+}
+
+func (s *RoomService) Delete(ctx context.Context, roomID, userID uint64) error {
+	if _, err := requirePermission(ctx, s.memberRepo, roomID, userID, models.PermissionDeleteRoom); err != nil {
+		return err
 	}
 
 	return s.roomRepo.Delete(ctx, roomID)
@@ -186,13 +541,22 @@ func (s *RoomService) GetMembers(ctx context.Context, roomID, userID uint64) ([]
 	return responses, nil
 }
 
-func (s *RoomService) AddMember(ctx context.Context, roomID, requesterID, userID uint64) error {
-	isMember, err := s.memberRepo.IsMember(ctx, roomID, requesterID)
+// AddMember adds a user to the room and returns the system message recording it
+func (s *RoomService) AddMember(ctx context.Context, roomID, requesterID, userID uint64) (*models.MessageResponse, error) {
+	if _, err := requirePermission(ctx, s.memberRepo, roomID, requesterID, models.PermissionInvite); err != nil {
+		return nil, err
+	}
+
+	room, err := s.roomRepo.GetByID(ctx, roomID)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if !isMember {
-		return ErrNotMember
+	if room.IsDirect() {
+		return nil, ErrDirectRoomMembers
+	}
+
+	if err := s.requireUser(ctx, userID); err != nil {
+		return nil, err
 	}
 
 	member := &models.RoomMember{
@@ -200,31 +564,255 @@ func (s *RoomService) AddMember(ctx context.Context, roomID, requesterID, userID
 		UserID: userID,
 		Role:   models.MemberRoleMember,
 	}
-	return s.memberRepo.Add(ctx, member)
+	if err := s.memberRepo.Add(ctx, member); err != nil {
+		return nil, memberAddError(err)
+	}
+
+	return s.postSystemMessage(ctx, roomID, requesterID, &models.SystemMessageMetadata{
+		Action: models.SystemActionMemberAdded,
+		Target: s.systemUser(ctx, userID),
+	}), nil
 }
 
-func (s *RoomService) RemoveMember(ctx context.Context, roomID, requesterID, userID uint64) error {
+// RemoveMember kicks a member and returns the system message recording it.
+// The requester's role must outrank the member's.
+func (s *RoomService) RemoveMember(ctx context.Context, roomID, requesterID, userID uint64) (*models.MessageResponse, error) {
 	room, err := s.roomRepo.GetByID(ctx, roomID)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if room.IsDirect() {
+		return nil, ErrDirectRoomMembers
 	}
 
-	if room.OwnerID != requesterID {
-		return ErrNotOwner
+	requester, err := requirePermission(ctx, s.memberRepo, roomID, requesterID, models.PermissionKick)
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.getTargetMember(ctx, roomID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !requester.Role.Outranks(target.Role) {
+		return nil, ErrPermissionDenied
 	}
 
-	return s.memberRepo.Remove(ctx, roomID, userID)
+	if err := s.memberRepo.Remove(ctx, roomID, userID); err != nil {
+		return nil, err
+	}
+
+	return s.postSystemMessage(ctx, roomID, requesterID, &models.SystemMessageMetadata{
+		Action: models.SystemActionMemberRemoved,
+		Target: s.systemUser(ctx, userID),
+	}), nil
 }
 
-func (s *RoomService) Leave(ctx context.Context, roomID, userID uint64) error {
+// SetMemberRole promotes a member to admin or demotes an admin to member
+func (s *RoomService) SetMemberRole(ctx context.Context, roomID, requesterID, userID uint64, role models.MemberRole) (*models.RoomMemberResponse, error) {
+	if role != models.MemberRoleAdmin && role != models.MemberRoleMember {
+		return nil, ErrInvalidRole
+	}
+
+	if _, err := requirePermission(ctx, s.memberRepo, roomID, requesterID, models.PermissionManageRoles); err != nil {
+		return nil, err
+	}
+	target, err := s.getTargetMember(ctx, roomID, userID)
+	if err != nil {
+		return nil, err
+	}
+	// The owner's role only changes through an ownership transfer
+	if target.Role == models.MemberRoleOwner {
+		return nil, ErrPermissionDenied
+	}
+
+	if target.Role != role {
+		if err := s.memberRepo.UpdateRole(ctx, roomID, userID, role); err != nil {
+			return nil, err
+		}
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.RoomMemberResponse{
+		User:     user.ToResponse(),
+		Role:     role,
+		JoinedAt: target.JoinedAt,
+	}, nil
+}
+
+// getTargetMember loads the member an action is applied to
+func (s *RoomService) getTargetMember(ctx context.Context, roomID, userID uint64) (*models.RoomMember, error) {
+	member, err := s.memberRepo.GetMember(ctx, roomID, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrMemberNotFound
+		}
+		return nil, err
+	}
+	return member, nil
+}
+
+// Leave removes the user from the room. An owner can only leave with transferOwnership set,
+// which hands the room to the oldest admin, or the oldest member if there is none. The
+// transfer (if any) and the system message recording the leave are returned for broadcast.
+func (s *RoomService) Leave(ctx context.Context, roomID, userID uint64, transferOwnership bool) (*models.OwnershipTransfer, *models.MessageResponse, error) {
 	room, err := s.roomRepo.GetByID(ctx, roomID)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
+	if room.IsDirect() {
+		return nil, nil, ErrDirectRoomMembers
+	}
+
+	var transfer *models.OwnershipTransfer
 	if room.OwnerID == userID {
-		return ErrOwnerCannotLeave
+		if !transferOwnership {
+			return nil, nil, ErrOwnerCannotLeave
+		}
+
+		successor, err := s.memberRepo.GetSuccessor(ctx, roomID, userID)
+		if err != nil {
+			// Nobody left to take over; the room has to be deleted instead
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, nil, ErrOwnerCannotLeave
+			}
+			return nil, nil, err
+		}
+
+		// The handover and the owner's departure commit together
+		transfer, err = s.transferOwnership(ctx, roomID, userID, successor.UserID, true)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else if err := s.memberRepo.Remove(ctx, roomID, userID); err != nil {
+		return nil, nil, err
+	}
+
+	systemMessage := s.postSystemMessage(ctx, roomID, userID, &models.SystemMessageMetadata{
+		Action: models.SystemActionMemberLeft,
+	})
+	return transfer, systemMessage, nil
+}
+
+// TransferOwnership hands the room over to another member; the previous owner becomes an admin
+func (s *RoomService) TransferOwnership(ctx context.Context, roomID, requesterID, newOwnerID uint64) (*models.OwnershipTransfer, error) {
+	if _, err := requirePermission(ctx, s.memberRepo, roomID, requesterID, models.PermissionTransferOwnership); err != nil {
+		return nil, err
+	}
+	if newOwnerID == requesterID {
+		return nil, ErrInvalidTransferTarget
+	}
+	if _, err := s.getTargetMember(ctx, roomID, newOwnerID); err != nil {
+		return nil, err
+	}
+
+	return s.transferOwnership(ctx, roomID, requesterID, newOwnerID, false)
+}
+
+// transferOwnership moves the room to newOwnerID; with leave set the previous owner is removed
+// from the room instead of becoming an admin
+func (s *RoomService) transferOwnership(ctx context.Context, roomID, previousOwnerID, newOwnerID uint64, leave bool) (*models.OwnershipTransfer, error) {
+	transfer := s.roomRepo.TransferOwnership
+	if leave {
+		transfer = s.roomRepo.TransferOwnershipAndLeave
+	}
+	if err := transfer(ctx, roomID, previousOwnerID, newOwnerID); err != nil {
+		if errors.Is(err, repository.ErrOwnershipChanged) {
+			return nil, ErrOwnershipChanged
+		}
+		return nil, err
 	}
 
-	return s.memberRepo.Remove(ctx, roomID, userID)
+	systemMessage := s.postSystemMessage(ctx, roomID, previousOwnerID, &models.SystemMessageMetadata{
+		Action: models.SystemActionOwnershipTransferred,
+		Target: s.systemUser(ctx, newOwnerID),
+	})
+
+	return &models.OwnershipTransfer{
+		RoomID:          roomID,
+		PreviousOwnerID: previousOwnerID,
+		NewOwnerID:      newOwnerID,
+		SystemMessage:   systemMessage,
+	}, nil
+}
+
+// postSystemMessage records a system message in the room, attributed to actorID. Failures
+// are only logged because the change it describes has already been made.
+func (s *RoomService) postSystemMessage(ctx context.Context, roomID, actorID uint64, metadata *models.SystemMessageMetadata) *models.MessageResponse {
+	metadata.Actor = s.systemUser(ctx, actorID)
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		log.Printf("[RoomService] Failed to encode system message metadata: %v", err)
+		return nil
+	}
+
+	msg := &models.Message{
+		RoomID:      roomID,
+		SenderID:    actorID,
+		Content:     systemMessageContent(metadata),
+		MessageType: models.MessageTypeSystem,
+		Metadata:    sql.NullString{String: string(data), Valid: true},
+	}
+	if err := s.messageRepo.Create(ctx, msg); err != nil {
+		log.Printf("[RoomService] Failed to post system message in room %d: %v", roomID, err)
+		return nil
+	}
+
+	var sender *models.UserResponse
+	if user, err := s.userRepo.GetByID(ctx, actorID); err == nil {
+		sender = user.ToResponse()
+	}
+	return msg.ToResponse(sender, 0)
+}
+
+// systemUser captures a user's current name for system message metadata
+func (s *RoomService) systemUser(ctx context.Context, userID uint64) *models.SystemUser {
+	user := &models.SystemUser{ID: userID}
+	if u, err := s.userRepo.GetByID(ctx, userID); err == nil {
+		user.Username = u.Username
+	} else {
+		user.Username = fmt.Sprintf("#%d", userID)
+	}
+	return user
+}
+
+// systemMessageContent is the default text of a system message, shown by clients that
+// don't render the metadata themselves
+func systemMessageContent(m *models.SystemMessageMetadata) string {
+	var target, oldValue, newValue string
+	if m.Target != nil {
+		target = m.Target.Username
+	}
+	if m.OldValue != nil {
+		oldValue = *m.OldValue
+	}
+	if m.NewValue != nil {
+		newValue = *m.NewValue
+	}
+
+	switch m.Action {
+	case models.SystemActionMemberAdded:
+		return fmt.Sprintf("%s님이 %s님을 초대했습니다", m.Actor.Username, target)
+	case models.SystemActionMemberRemoved:
+		return fmt.Sprintf("%s님이 %s님을 내보냈습니다", m.Actor.Username, target)
+	case models.SystemActionMemberJoined:
+		if m.Target == nil {
+			return fmt.Sprintf("%s님이 참여했습니다", m.Actor.Username)
+		}
+		return fmt.Sprintf("%s님이 %s님의 초대 링크로 참여했습니다", m.Actor.Username, target)
+	case models.SystemActionMemberLeft:
+		return fmt.Sprintf("%s님이 나갔습니다", m.Actor.Username)
+	case models.SystemActionRoomRenamed:
+		return fmt.Sprintf("%s님이 채팅방 이름을 '%s'에서 '%s'(으)로 변경했습니다", m.Actor.Username, oldValue, newValue)
+	case models.SystemActionDescriptionChanged:
+		return fmt.Sprintf("%s님이 채팅방 설명을 변경했습니다", m.Actor.Username)
+	case models.SystemActionOwnershipTransferred:
+		return fmt.Sprintf("%s님이 %s님에게 방장을 넘겼습니다", m.Actor.Username, target)
+	default:
+		return string(m.Action)
+	}
 }
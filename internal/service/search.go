@@ -0,0 +1,109 @@
+package service
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"Mmessenger/internal/models"
+)
+
+const (
+	// snippetContext is the number of runes kept before the first match
+	snippetContext = 30
+	// snippetLength is the maximum number of content runes in a snippet
+	snippetLength   = 120
+	snippetEllipsis = "..."
+)
+
+// searchTerms splits a user query into terms, dropping characters that are
+// operators in MySQL BOOLEAN MODE so user input cannot change the query shape.
+func searchTerms(query string) []string {
+	clean := strings.Map(func(r rune) rune {
+		switch r {
+		case '+', '-', '<', '>', '(', ')', '~', '*', '"', '@':
+			return ' '
+		}
+		return r
+	}, query)
+	return strings.Fields(clean)
+}
+
+// booleanQuery requires every term to appear, e.g. `+"hello" +"world"`
+func booleanQuery(terms []string) string {
+	parts := make([]string, len(terms))
+	for i, term := range terms {
+		parts[i] = `+"` + term + `"`
+	}
+	return strings.Join(parts, " ")
+}
+
+// buildSnippet cuts a window of content around the first matched term and
+// returns the rune ranges of every term occurrence inside that window.
+func buildSnippet(content string, terms []string) (string, []models.HighlightRange) {
+	runes := []rune(content)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	type match struct{ start, end int }
+	var matches []match
+	for _, term := range terms {
+		needle := []rune(strings.ToLower(term))
+		if len(needle) == 0 {
+			continue
+		}
+		for i := 0; i+len(needle) <= len(lower); i++ {
+			if string(lower[i:i+len(needle)]) == string(needle) {
+				matches = append(matches, match{i, i + len(needle)})
+			}
+		}
+	}
+
+	first := 0
+	if len(matches) > 0 {
+		first = matches[0].start
+		for _, m := range matches {
+			if m.start < first {
+				first = m.start
+			}
+		}
+	}
+
+	start := first - snippetContext
+	if start < 0 {
+		start = 0
+	}
+	end := start + snippetLength
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	var b strings.Builder
+	offset := -start
+	if start > 0 {
+		b.WriteString(snippetEllipsis)
+		offset += len([]rune(snippetEllipsis))
+	}
+	b.WriteString(string(runes[start:end]))
+	if end < len(runes) {
+		b.WriteString(snippetEllipsis)
+	}
+
+	highlights := []models.HighlightRange{}
+	for _, m := range matches {
+		if m.start < start || m.end > end {
+			continue
+		}
+		highlights = append(highlights, models.HighlightRange{
+			Start: m.start + offset,
+			End:   m.end + offset,
+		})
+	}
+
+	sort.Slice(highlights, func(i, j int) bool {
+		return highlights[i].Start < highlights[j].Start
+	})
+	return b.String(), highlights
+}
@@ -3,8 +3,10 @@ package websocket
 import (
 	"encoding/json"
 	"log"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
@@ -16,24 +18,51 @@ const (
 )
 
 type Client struct {
-	hub      *Hub
-	conn     *websocket.Conn
-	send     chan []byte
-	UserID   uint64
-	Username string
-	rooms    map[uint64]bool
-	handler  *Handler
+	hub       *Hub
+	conn      *websocket.Conn
+	send      chan []byte
+	UserID    uint64
+	Username  string
+	DeviceID  string // client-supplied device identifier, falls back to SessionID
+	SessionID string // unique per connection
+	rooms     map[uint64]bool
+	removed   bool // set once the hub has dropped the client; guarded by Hub.mu
+	handler   *Handler
+
+	lastActive atomic.Int64 // unix nanoseconds of the last message other than a ping
+	idle       atomic.Bool  // whether presence was last reported as away
 }
 
-func NewClient(hub *Hub, conn *websocket.Conn, userID uint64, username string, handler *Handler) *Client {
-	return &Client{
-		hub:      hub,
-		conn:     conn,
-		send:     make(chan []byte, 256),
-		UserID:   userID,
-		Username: username,
-		rooms:    make(map[uint64]bool),
-		handler:  handler,
+func NewClient(hub *Hub, conn *websocket.Conn, userID uint64, username, deviceID string, handler *Handler) *Client {
+	sessionID := uuid.New().String()
+	if deviceID == "" {
+		deviceID = sessionID
+	}
+
+	c := &Client{
+		hub:       hub,
+		conn:      conn,
+		send:      make(chan []byte, 256),
+		UserID:    userID,
+		Username:  username,
+		DeviceID:  deviceID,
+		SessionID: sessionID,
+		rooms:     make(map[uint64]bool),
+		handler:   handler,
+	}
+	c.lastActive.Store(time.Now().UnixNano())
+	return c
+}
+
+func (c *Client) lastActiveAt() time.Time {
+	return time.Unix(0, c.lastActive.Load())
+}
+
+// markActive records user activity; a client that was away is reported online right away
+func (c *Client) markActive() {
+	c.lastActive.Store(time.Now().UnixNano())
+	if c.idle.Load() {
+		c.hub.reportPresence(c)
 	}
 }
 
@@ -41,7 +70,7 @@ func (c *Client) ReadPump() {
 	defer func() {
 		c.hub.unregister <- c
 		c.conn.Close()
-		c.hub.BroadcastPresence(c.UserID, "offline")
+		c.hub.disconnectPresence(c)
 	}()
 
 	c.conn.SetReadLimit(maxMessageSize)
@@ -66,6 +95,10 @@ func (c *Client) ReadPump() {
 			continue
 		}
 
+		// Keepalive pings don't count as activity for idle detection
+		if msg.Type != TypePing {
+			c.markActive()
+		}
 		c.handler.HandleMessage(c, &msg)
 	}
 }
@@ -96,6 +129,8 @@ func (c *Client) WritePump() {
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
+			// Keep this connection's presence entry from expiring
+			c.hub.reportPresence(c)
 		}
 	}
 }
@@ -112,6 +147,15 @@ func (c *Client) Send(msg *WSMessage) {
 	}
 }
 
+func (c *Client) sendAck(requestID string, payload interface{}) {
+	c.Send(&WSMessage{
+		Type:      TypeAck,
+		Payload:   payload,
+		Timestamp: time.Now(),
+		RequestID: requestID,
+	})
+}
+
 func (c *Client) sendError(code, message, requestID string) {
 	msg := &WSMessage{
 		Type: TypeError,
@@ -3,6 +3,7 @@ package websocket
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"time"
@@ -28,20 +29,24 @@ type Handler struct {
 	keycloakService *keycloak.Service
 	authService     *service.AuthService
 	messageService  *service.MessageService
+	reactionService *service.ReactionService
 	pushService     *service.PushService
+	eventService    *service.EventService
 	memberRepo      *repository.RoomMemberRepository
 	userRepo        *repository.UserRepository
 	roomRepo        *repository.RoomRepository
 	messageRepo     *repository.MessageRepository
 }
 
-func NewHandler(hub *Hub, keycloakService *keycloak.Service, authService *service.AuthService, messageService *service.MessageService, pushService *service.PushService, memberRepo *repository.RoomMemberRepository, userRepo *repository.UserRepository, roomRepo *repository.RoomRepository, messageRepo *repository.MessageRepository) *Handler {
+func NewHandler(hub *Hub, keycloakService *keycloak.Service, authService *service.AuthService, messageService *service.MessageService, reactionService *service.ReactionService, pushService *service.PushService, eventService *service.EventService, memberRepo *repository.RoomMemberRepository, userRepo *repository.UserRepository, roomRepo *repository.RoomRepository, messageRepo *repository.MessageRepository) *Handler {
 	return &Handler{
 		hub:             hub,
 		keycloakService: keycloakService,
 		authService:     authService,
 		messageService:  messageService,
+		reactionService: reactionService,
 		pushService:     pushService,
+		eventService:    eventService,
 		memberRepo:      memberRepo,
 		userRepo:        userRepo,
 		roomRepo:        roomRepo,
@@ -74,11 +79,13 @@ func (h *Handler) ServeWS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	client := NewClient(h.hub, conn, user.ID, user.Username, h)
-	h.hub.register <- client
+	// device_id lets a user keep one session per device (laptop, phone, ...)
+	deviceID := r.URL.Query().Get("device_id")
 
-	// Broadcast online status
-	h.hub.BroadcastPresence(user.ID, "online")
+	client := NewClient(h.hub, conn, user.ID, user.Username, deviceID, h)
+	h.hub.register <- client
+	// Announces the user online when this is their first connection on any server
+	h.hub.reportPresence(client)
 
 	go client.WritePump()
 	go client.ReadPump()
@@ -96,6 +103,14 @@ func (h *Handler) HandleMessage(client *Client, msg *WSMessage) {
 		h.handleTyping(client, msg)
 	case TypeMarkRead:
 		h.handleMarkRead(client, msg)
+	case TypeAddReaction, TypeRemoveReaction:
+		h.handleReaction(client, msg)
+	case TypeEditMessage:
+		h.handleEditMessage(client, msg)
+	case TypeDeleteMessage:
+		h.handleDeleteMessage(client, msg)
+	case TypeResume:
+		h.handleResume(client, msg)
 	case TypePing:
 		h.handlePing(client)
 	default:
@@ -128,25 +143,6 @@ func (h *Handler) handleJoinRoom(client *Client, msg *WSMessage) {
 		},
 		Timestamp: time.Now(),
 	})
-
-	// Get member count
-	memberCount, _ := h.roomRepo.GetMemberCount(context.Background(), payload.RoomID)
-
-	// Notify other members
-	user, _ := h.userRepo.GetByID(context.Background(), client.UserID)
-	notification := &WSMessage{
-		Type: TypeUserJoined,
-		Payload: UserJoinedPayload{
-			RoomID:      payload.RoomID,
-			User:        user.ToResponse(),
-			MemberCount: memberCount,
-		},
-		Timestamp: time.Now(),
-	}
-
-	if data, err := marshalMessage(notification); err == nil {
-		h.hub.BroadcastToRoom(payload.RoomID, data, nil) // nil로 변경하여 본인 포함 모두에게 전송
-	}
 }
 
 func (h *Handler) handleLeaveRoom(client *Client, msg *WSMessage) {
@@ -167,25 +163,6 @@ func (h *Handler) handleLeaveRoom(client *Client, msg *WSMessage) {
 		},
 		Timestamp: time.Now(),
 	})
-
-	// Get member count
-	memberCount, _ := h.roomRepo.GetMemberCount(context.Background(), payload.RoomID)
-
-	// Notify other members
-	notification := &WSMessage{
-		Type: TypeUserLeft,
-		Payload: UserLeftPayload{
-			RoomID:      payload.RoomID,
-			UserID:      client.UserID,
-			Username:    client.Username,
-			MemberCount: memberCount,
-		},
-		Timestamp: time.Now(),
-	}
-
-	if data, err := marshalMessage(notification); err == nil {
-		h.hub.BroadcastToRoom(payload.RoomID, data, nil) // 본인 포함 모두에게 전송
-	}
 }
 
 func (h *Handler) handleSendMessage(client *Client, msg *WSMessage) {
@@ -203,40 +180,47 @@ func (h *Handler) handleSendMessage(client *Client, msg *WSMessage) {
 
 	// Save message to database
 	req := &models.SendMessageRequest{
-		Content:      payload.Content,
-		MessageType:  payload.MessageType,
-		FileURL:      payload.FileURL,
-		ThumbnailURL: payload.ThumbnailURL,
+		Content:         payload.Content,
+		MessageType:     payload.MessageType,
+		FileURL:         payload.FileURL,
+		ThumbnailURL:    payload.ThumbnailURL,
+		ParentID:        payload.ParentID,
+		ClientMessageID: payload.ClientMessageID,
 	}
 
-	savedMsg, err := h.messageService.Create(context.Background(), payload.RoomID, client.UserID, req)
+	savedMsg, created, err := h.messageService.Create(context.Background(), payload.RoomID, client.UserID, req)
 	if err != nil {
+		if errors.Is(err, service.ErrInvalidParent) {
+			client.sendError("INVALID_PARENT", "Reply target not found in this room", msg.RequestID)
+			return
+		}
+		if errors.Is(err, service.ErrInvalidClientMessageID) || errors.Is(err, service.ErrClientMessageIDInUse) {
+			client.sendError("INVALID_CLIENT_MESSAGE_ID", err.Error(), msg.RequestID)
+			return
+		}
+		if errors.Is(err, service.ErrSystemMessage) {
+			client.sendError("INVALID_MESSAGE_TYPE", "System messages cannot be sent by clients", msg.RequestID)
+			return
+		}
 		client.sendError("SEND_FAILED", "Failed to send message", msg.RequestID)
 		return
 	}
 
-	// Broadcast to room members
-	notification := &WSMessage{
-		Type: TypeNewMessage,
-		Payload: NewMessagePayload{
-			ID:           savedMsg.ID,
-			RoomID:       payload.RoomID,
-			Sender:       savedMsg.Sender,
-			Content:      savedMsg.Content,
-			MessageType:  savedMsg.MessageType,
-			FileURL:      savedMsg.FileURL,
-			ThumbnailURL: savedMsg.ThumbnailURL,
-			CreatedAt:    savedMsg.CreatedAt,
-			UnreadCount:  savedMsg.UnreadCount,
-		},
-		Timestamp: time.Now(),
-	}
+	// Let the sender reconcile its optimistic message with the stored one
+	client.sendAck(msg.RequestID, AckPayload{
+		MessageID:       savedMsg.ID,
+		ClientMessageID: savedMsg.ClientMessageID,
+	})
 
-	if data, err := marshalMessage(notification); err == nil {
-		// Send to all room members including sender
-		h.hub.BroadcastToRoom(payload.RoomID, data, nil)
+	// A resend of an already stored message was broadcast the first time around
+	if !created {
+		return
 	}
 
+	// Broadcast to room members including sender
+	h.hub.BroadcastNewMessage(savedMsg)
+	h.hub.SendMentions(savedMsg)
+
 	// Send unread count updates to all room members (except sender)
 	go func() {
 		memberIDs, err := h.memberRepo.GetUserIDsByRoomID(context.Background(), payload.RoomID)
@@ -304,11 +288,76 @@ func (h *Handler) handleSendMessage(client *Client, msg *WSMessage) {
 				},
 			}
 
-			h.pushService.SendToRoomMembers(context.Background(), payload.RoomID, client.UserID, pushNotif)
+			h.pushService.SendToRoomMembers(context.Background(), payload.RoomID, client.UserID, savedMsg.MentionedUserIDs, pushNotif)
 		}()
 	}
 }
 
+func (h *Handler) handleEditMessage(client *Client, msg *WSMessage) {
+	payloadBytes, _ := json.Marshal(msg.Payload)
+	var payload EditMessagePayload
+	if err := json.Unmarshal(payloadBytes, &payload); err != nil {
+		client.sendError("INVALID_PAYLOAD", "Invalid payload", msg.RequestID)
+		return
+	}
+
+	if payload.Content == "" {
+		client.sendError("EMPTY_CONTENT", "Message content cannot be empty", msg.RequestID)
+		return
+	}
+
+	req := &models.UpdateMessageRequest{Content: payload.Content}
+	updated, err := h.messageService.Update(context.Background(), payload.RoomID, payload.MessageID, client.UserID, req)
+	if err != nil {
+		h.sendMessageError(client, err, "EDIT_FAILED", "Failed to edit message", msg.RequestID)
+		return
+	}
+
+	client.sendAck(msg.RequestID, AckPayload{MessageID: updated.ID})
+	h.hub.BroadcastMessageUpdated(updated)
+}
+
+func (h *Handler) handleDeleteMessage(client *Client, msg *WSMessage) {
+	payloadBytes, _ := json.Marshal(msg.Payload)
+	var payload DeleteMessagePayload
+	if err := json.Unmarshal(payloadBytes, &payload); err != nil {
+		client.sendError("INVALID_PAYLOAD", "Invalid payload", msg.RequestID)
+		return
+	}
+
+	deleted, unpinned, err := h.messageService.Delete(context.Background(), payload.RoomID, payload.MessageID, client.UserID)
+	if err != nil {
+		h.sendMessageError(client, err, "DELETE_FAILED", "Failed to delete message", msg.RequestID)
+		return
+	}
+
+	client.sendAck(msg.RequestID, AckPayload{MessageID: deleted.ID})
+	h.hub.BroadcastMessageDeleted(deleted.RoomID, deleted.ID)
+	if unpinned {
+		h.hub.BroadcastMessageUnpinned(deleted.RoomID, deleted.ID, client.UserID)
+	}
+}
+
+// sendMessageError maps MessageService errors to WebSocket error codes
+func (h *Handler) sendMessageError(client *Client, err error, code, message, requestID string) {
+	switch {
+	case errors.Is(err, service.ErrMessageNotFound):
+		client.sendError("MESSAGE_NOT_FOUND", "Message not found", requestID)
+	case errors.Is(err, service.ErrNotOwner):
+		client.sendError("NOT_OWNER", "You can only change your own messages", requestID)
+	case errors.Is(err, service.ErrNotMember):
+		client.sendError("NOT_MEMBER", "You are not a member of this room", requestID)
+	case errors.Is(err, service.ErrPermissionDenied):
+		client.sendError("PERMISSION_DENIED", "You don't have permission to do this in this room", requestID)
+	case errors.Is(err, service.ErrEditWindowPast):
+		client.sendError("EDIT_WINDOW_PASSED", "The edit window for this message has passed", requestID)
+	case errors.Is(err, service.ErrSystemMessage):
+		client.sendError("SYSTEM_MESSAGE", "System messages cannot be changed", requestID)
+	default:
+		client.sendError(code, message, requestID)
+	}
+}
+
 func (h *Handler) handleTyping(client *Client, msg *WSMessage) {
 	payloadBytes, _ := json.Marshal(msg.Payload)
 	var payload TypingPayload
@@ -339,22 +388,132 @@ func (h *Handler) handleMarkRead(client *Client, msg *WSMessage) {
 		return
 	}
 
-	h.memberRepo.UpdateLastRead(context.Background(), payload.RoomID, client.UserID)
+	// message_id of 0 marks everything in the room as read
+	lastRead, err := h.messageService.MarkRead(context.Background(), payload.RoomID, client.UserID, payload.MessageID)
+	if err != nil {
+		if errors.Is(err, service.ErrNotMember) {
+			client.sendError("NOT_MEMBER", "You are not a member of this room", msg.RequestID)
+		}
+		return
+	}
 
 	// Broadcast read status to room members
 	notification := &WSMessage{
 		Type: TypeMessageRead,
 		Payload: MessageReadPayload{
-			RoomID:   payload.RoomID,
-			UserID:   client.UserID,
-			Username: client.Username,
+			RoomID:            payload.RoomID,
+			UserID:            client.UserID,
+			Username:          client.Username,
+			LastReadMessageID: lastRead,
 		},
 		Timestamp: time.Now(),
 	}
 
-	if data, err := marshalMessage(notification); err == nil {
-		h.hub.BroadcastToRoom(payload.RoomID, data, client)
+	h.hub.BroadcastRoomEvent(payload.RoomID, notification, client)
+}
+
+func (h *Handler) handleReaction(client *Client, msg *WSMessage) {
+	payloadBytes, _ := json.Marshal(msg.Payload)
+	var payload ReactionPayload
+	if err := json.Unmarshal(payloadBytes, &payload); err != nil {
+		client.sendError("INVALID_PAYLOAD", "Invalid payload", msg.RequestID)
+		return
+	}
+
+	var update *models.ReactionUpdate
+	var changed bool
+	var err error
+	if msg.Type == TypeAddReaction {
+		update, changed, err = h.reactionService.Add(context.Background(), payload.RoomID, payload.MessageID, client.UserID, payload.Emoji)
+	} else {
+		update, changed, err = h.reactionService.Remove(context.Background(), payload.RoomID, payload.MessageID, client.UserID, payload.Emoji)
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidEmoji):
+			client.sendError("INVALID_EMOJI", "Invalid emoji", msg.RequestID)
+		case errors.Is(err, service.ErrNotMember):
+			client.sendError("NOT_MEMBER", "You are not a member of this room", msg.RequestID)
+		case errors.Is(err, service.ErrMessageNotFound):
+			client.sendError("MESSAGE_NOT_FOUND", "Message not found", msg.RequestID)
+		default:
+			client.sendError("REACTION_FAILED", "Failed to update reaction", msg.RequestID)
+		}
+		return
 	}
+
+	// Nothing changed for the room; only bring the sender's view up to date
+	if !changed {
+		client.Send(&WSMessage{
+			Type:      TypeReactionUpdated,
+			Payload:   update,
+			Timestamp: time.Now(),
+		})
+		return
+	}
+	h.hub.BroadcastReactionUpdate(update)
+}
+
+// handleResume replays the events a client missed across all of its rooms since last_seq.
+// A last_seq of 0 only reports where to resume from next time.
+func (h *Handler) handleResume(client *Client, msg *WSMessage) {
+	payloadBytes, _ := json.Marshal(msg.Payload)
+	var payload ResumePayload
+	if err := json.Unmarshal(payloadBytes, &payload); err != nil {
+		client.sendError("INVALID_PAYLOAD", "Invalid payload", msg.RequestID)
+		return
+	}
+
+	ctx := context.Background()
+	lastSeq := payload.LastSeq
+
+	var events []*models.Event
+	var err error
+	if lastSeq == 0 {
+		lastSeq, err = h.eventService.LatestSeq(ctx)
+	} else {
+		events, err = h.eventService.Replay(ctx, client.UserID, lastSeq)
+	}
+	if err != nil {
+		if !errors.Is(err, service.ErrResyncRequired) {
+			client.sendError("RESUME_FAILED", "Failed to replay missed events", msg.RequestID)
+			return
+		}
+
+		latest, err := h.eventService.LatestSeq(ctx)
+		if err != nil {
+			client.sendError("RESUME_FAILED", "Failed to replay missed events", msg.RequestID)
+			return
+		}
+		client.Send(&WSMessage{
+			Type:      TypeResyncRequired,
+			Payload:   ResyncRequiredPayload{LastSeq: latest},
+			Timestamp: time.Now(),
+			RequestID: msg.RequestID,
+		})
+		return
+	}
+
+	for _, event := range events {
+		client.Send(&WSMessage{
+			Type:      MessageType(event.EventType),
+			Payload:   event.Payload,
+			Timestamp: event.CreatedAt,
+			Seq:       event.ID,
+		})
+		lastSeq = event.ID
+	}
+
+	client.Send(&WSMessage{
+		Type: TypeResumed,
+		Payload: ResumedPayload{
+			LastSeq:  lastSeq,
+			Replayed: len(events),
+		},
+		Timestamp: time.Now(),
+		RequestID: msg.RequestID,
+	})
 }
 
 func (h *Handler) handlePing(client *Client) {
@@ -2,23 +2,31 @@ package websocket
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"log"
 	"sync"
 	"time"
 
+	"Mmessenger/internal/models"
 	"Mmessenger/internal/pubsub"
+	"Mmessenger/internal/service"
 )
 
 type Hub struct {
 	clients    map[*Client]bool
 	rooms      map[uint64]map[*Client]bool
-	userConns  map[uint64]*Client
+	userConns  map[uint64]map[*Client]bool
 	broadcast  chan *BroadcastMessage
 	register   chan *Client
 	unregister chan *Client
 	mu         sync.RWMutex
-	pubsub     *pubsub.RedisPubSub
+	pubsub     pubsub.Broker
+	subs       *subscriptions
+	events     *service.EventService
+	presence   *service.PresenceService
+
+	presenceCoalescer *presenceCoalescer
 }
 
 type BroadcastMessage struct {
@@ -27,16 +35,20 @@ type BroadcastMessage struct {
 	Sender  *Client
 }
 
-func NewHub(ps *pubsub.RedisPubSub) *Hub {
+func NewHub(ps pubsub.Broker, events *service.EventService, presence *service.PresenceService) *Hub {
 	h := &Hub{
 		clients:    make(map[*Client]bool),
 		rooms:      make(map[uint64]map[*Client]bool),
-		userConns:  make(map[uint64]*Client),
+		userConns:  make(map[uint64]map[*Client]bool),
 		broadcast:  make(chan *BroadcastMessage, 256),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
 		pubsub:     ps,
+		subs:       newSubscriptions(ps),
+		events:     events,
+		presence:   presence,
 	}
+	h.presenceCoalescer = newPresenceCoalescer(presenceCoalesceWindow, h.flushPresence)
 
 	if ps != nil {
 		h.setupPubSubHandlers()
@@ -46,17 +58,13 @@ func NewHub(ps *pubsub.RedisPubSub) *Hub {
 }
 
 func (h *Hub) setupPubSubHandlers() {
-	h.pubsub.OnMessage(pubsub.ChannelRoomMessage, func(msg *pubsub.Message) {
+	h.pubsub.OnMessage(pubsub.ChannelRoomPrefix, func(msg *pubsub.Message) {
 		h.handlePubSubRoomMessage(msg)
 	})
 
-	h.pubsub.OnMessage(pubsub.ChannelUserMessage, func(msg *pubsub.Message) {
+	h.pubsub.OnMessage(pubsub.ChannelUserPrefix, func(msg *pubsub.Message) {
 		h.handlePubSubUserMessage(msg)
 	})
-
-	h.pubsub.OnMessage(pubsub.ChannelPresence, func(msg *pubsub.Message) {
-		h.handlePubSubPresence(msg)
-	})
 }
 
 func (h *Hub) handlePubSubRoomMessage(msg *pubsub.Message) {
@@ -80,53 +88,7 @@ func (h *Hub) handlePubSubRoomMessage(msg *pubsub.Message) {
 }
 
 func (h *Hub) handlePubSubUserMessage(msg *pubsub.Message) {
-	h.mu.RLock()
-	client, ok := h.userConns[msg.UserID]
-	h.mu.RUnlock()
-
-	if ok {
-		select {
-		case client.send <- msg.Payload:
-		default:
-		}
-	}
-}
-
-func (h *Hub) handlePubSubPresence(msg *pubsub.Message) {
-	var payload struct {
-		UserID uint64 `json:"user_id"`
-		Status string `json:"status"`
-	}
-	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
-		log.Printf("Failed to unmarshal presence payload: %v", err)
-		return
-	}
-
-	wsMsg := &WSMessage{
-		Type: TypePresenceUpdate,
-		Payload: map[string]interface{}{
-			"user_id": payload.UserID,
-			"status":  payload.Status,
-		},
-		Timestamp: time.Now(),
-	}
-
-	data, err := marshalMessage(wsMsg)
-	if err != nil {
-		return
-	}
-
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-
-	for client := range h.clients {
-		if client.UserID != payload.UserID {
-			select {
-			case client.send <- data:
-			default:
-			}
-		}
-	}
+	h.sendToLocalUser(msg.UserID, msg.Payload)
 }
 
 func (h *Hub) Run() {
@@ -135,29 +97,24 @@ func (h *Hub) Run() {
 		case client := <-h.register:
 			h.mu.Lock()
 			h.clients[client] = true
-			h.userConns[client.UserID] = client
+			conns, ok := h.userConns[client.UserID]
+			if !ok {
+				conns = make(map[*Client]bool)
+				h.userConns[client.UserID] = conns
+			}
+			conns[client] = true
 			h.mu.Unlock()
 
+			h.subs.acquire(pubsub.UserChannel(client.UserID))
+
+			log.Printf("[Hub] Registered user %d device %s session %s (%d connections)",
+				client.UserID, client.DeviceID, client.SessionID, h.UserConnectionCount(client.UserID))
+
 		case client := <-h.unregister:
-			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				delete(h.userConns, client.UserID)
-				close(client.send)
-
-				// Remove from all rooms
-				for roomID := range client.rooms {
-					if room, ok := h.rooms[roomID]; ok {
-						delete(room, client)
-						if len(room) == 0 {
-							delete(h.rooms, roomID)
-						}
-					}
-				}
-			}
-			h.mu.Unlock()
+			h.dropClient(client)
 
 		case msg := <-h.broadcast:
+			var slow []*Client
 			h.mu.RLock()
 			if room, ok := h.rooms[msg.RoomID]; ok {
 				for client := range room {
@@ -165,37 +122,86 @@ func (h *Hub) Run() {
 						select {
 						case client.send <- msg.Message:
 						default:
-							h.mu.RUnlock()
-							h.mu.Lock()
-							close(client.send)
-							delete(h.clients, client)
-							delete(room, client)
-							h.mu.Unlock()
-							h.mu.RLock()
+							slow = append(slow, client)
 						}
 					}
 				}
 			}
 			h.mu.RUnlock()
+
+			// Drop clients whose send buffer is full
+			for _, client := range slow {
+				h.dropClient(client)
+			}
 		}
 	}
 }
 
-func (h *Hub) JoinRoom(client *Client, roomID uint64) {
+// dropClient removes a client from the hub and releases its channels. Presence is
+// updated by the client's read pump once the connection has closed.
+func (h *Hub) dropClient(client *Client) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
+	channels := h.removeClient(client)
+	h.mu.Unlock()
+
+	h.subs.release(channels...)
+}
+
+// removeClient detaches a client from the hub and closes its send channel. It returns the
+// broker channels the client held. Callers must hold h.mu.
+func (h *Hub) removeClient(client *Client) []string {
+	if _, ok := h.clients[client]; !ok {
+		return nil
+	}
+
+	delete(h.clients, client)
+	close(client.send)
+	client.removed = true
+	channels := []string{pubsub.UserChannel(client.UserID)}
+
+	// Remove from all rooms
+	for roomID := range client.rooms {
+		channels = append(channels, pubsub.RoomChannel(roomID))
+		if room, ok := h.rooms[roomID]; ok {
+			delete(room, client)
+			if len(room) == 0 {
+				delete(h.rooms, roomID)
+			}
+		}
+	}
 
+	if conns, ok := h.userConns[client.UserID]; ok {
+		delete(conns, client)
+		if len(conns) == 0 {
+			delete(h.userConns, client.UserID)
+		}
+	}
+	return channels
+}
+
+func (h *Hub) JoinRoom(client *Client, roomID uint64) {
+	h.mu.Lock()
+	// A dropped client's read pump may still be running; it must not hold rooms again
+	if client.removed {
+		h.mu.Unlock()
+		return
+	}
+	joined := !client.rooms[roomID]
 	if h.rooms[roomID] == nil {
 		h.rooms[roomID] = make(map[*Client]bool)
 	}
 	h.rooms[roomID][client] = true
 	client.rooms[roomID] = true
+	h.mu.Unlock()
+
+	if joined {
+		h.subs.acquire(pubsub.RoomChannel(roomID))
+	}
 }
 
 func (h *Hub) LeaveRoom(client *Client, roomID uint64) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
-
+	left := client.rooms[roomID]
 	if room, ok := h.rooms[roomID]; ok {
 		delete(room, client)
 		if len(room) == 0 {
@@ -203,6 +209,11 @@ func (h *Hub) LeaveRoom(client *Client, roomID uint64) {
 		}
 	}
 	delete(client.rooms, roomID)
+	h.mu.Unlock()
+
+	if left {
+		h.subs.release(pubsub.RoomChannel(roomID))
+	}
 }
 
 func (h *Hub) BroadcastToRoom(roomID uint64, message []byte, sender *Client) {
@@ -213,32 +224,85 @@ func (h *Hub) BroadcastToRoom(roomID uint64, message []byte, sender *Client) {
 		Sender:  sender,
 	}
 
-	// Publish to Redis for other servers
+	// Publish for other servers
 	if h.pubsub != nil {
 		if err := h.pubsub.PublishRoomMessage(context.Background(), roomID, message); err != nil {
-			log.Printf("Failed to publish room message to Redis: %v", err)
+			log.Printf("Failed to publish room message: %v", err)
 		}
 	}
 }
 
+// BroadcastRoomEvent records a room event for replay and delivers it to the room on all servers
+func (h *Hub) BroadcastRoomEvent(roomID uint64, msg *WSMessage, sender *Client) {
+	h.recordEvent(msg, roomID, 0)
+
+	if data, err := marshalMessage(msg); err == nil {
+		h.BroadcastToRoom(roomID, data, sender)
+	}
+}
+
+// SendUserEvent records an event for replay and delivers it to every connection of the user
+func (h *Hub) SendUserEvent(userID uint64, msg *WSMessage) {
+	h.recordEvent(msg, 0, userID)
+
+	if data, err := marshalMessage(msg); err == nil {
+		h.SendToUser(userID, data)
+	}
+}
+
+// recordEvent appends msg to the replay log and stamps it with its sequence number.
+// Delivery goes ahead without a sequence when the log is unavailable.
+func (h *Hub) recordEvent(msg *WSMessage, roomID, userID uint64) {
+	if h.events == nil {
+		return
+	}
+
+	payload, err := json.Marshal(msg.Payload)
+	if err != nil {
+		return
+	}
+
+	event := &models.Event{
+		EventType: string(msg.Type),
+		Payload:   payload,
+	}
+	if roomID != 0 {
+		event.RoomID = sql.NullInt64{Int64: int64(roomID), Valid: true}
+	}
+	if userID != 0 {
+		event.UserID = sql.NullInt64{Int64: int64(userID), Valid: true}
+	}
+
+	if err := h.events.Record(context.Background(), event); err != nil {
+		log.Printf("Failed to record %s event: %v", msg.Type, err)
+		return
+	}
+	msg.Seq = event.ID
+}
+
+// SendToUser delivers a message to every connection of the user on all servers
 func (h *Hub) SendToUser(userID uint64, message []byte) {
+	h.sendToLocalUser(userID, message)
+
+	// Also publish for other servers
+	if h.pubsub != nil {
+		if err := h.pubsub.PublishUserMessage(context.Background(), userID, message); err != nil {
+			log.Printf("Failed to publish user message: %v", err)
+		}
+	}
+}
+
+// sendToLocalUser delivers a message to every connection of the user on this server
+func (h *Hub) sendToLocalUser(userID uint64, message []byte) {
 	h.mu.RLock()
-	client, ok := h.userConns[userID]
-	h.mu.RUnlock()
+	defer h.mu.RUnlock()
 
-	if ok {
+	for client := range h.userConns[userID] {
 		select {
 		case client.send <- message:
 		default:
 		}
 	}
-
-	// Also publish to Redis for other servers
-	if h.pubsub != nil {
-		if err := h.pubsub.PublishUserMessage(context.Background(), userID, message); err != nil {
-			log.Printf("Failed to publish user message to Redis: %v", err)
-		}
-	}
 }
 
 func (h *Hub) GetRoomMembers(roomID uint64) []uint64 {
@@ -246,50 +310,97 @@ func (h *Hub) GetRoomMembers(roomID uint64) []uint64 {
 	defer h.mu.RUnlock()
 
 	var userIDs []uint64
+	seen := make(map[uint64]bool)
 	if room, ok := h.rooms[roomID]; ok {
 		for client := range room {
+			// A user may be in the room from several devices
+			if seen[client.UserID] {
+				continue
+			}
+			seen[client.UserID] = true
 			userIDs = append(userIDs, client.UserID)
 		}
 	}
 	return userIDs
 }
 
+// IsUserOnline reports whether the user is connected to any server
 func (h *Hub) IsUserOnline(userID uint64) bool {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-	_, ok := h.userConns[userID]
-	return ok
+	if h.UserConnectionCount(userID) > 0 {
+		return true
+	}
+	if h.presence == nil {
+		return false
+	}
+
+	online, err := h.presence.IsOnline(context.Background(), userID)
+	if err != nil {
+		log.Printf("[Hub] Failed to look up presence of user %d: %v", userID, err)
+		return false
+	}
+	return online
 }
 
-func (h *Hub) BroadcastPresence(userID uint64, status string) {
-	msg := &WSMessage{
-		Type: TypePresenceUpdate,
-		Payload: map[string]interface{}{
-			"user_id": userID,
-			"status":  status,
-		},
-		Timestamp: time.Now(),
+// reportPresence refreshes the client's presence entry, as away when it has been idle for
+// the idle timeout and online otherwise, and announces any resulting status change
+func (h *Hub) reportPresence(client *Client) {
+	if h.presence == nil {
+		return
+	}
+
+	idle := time.Since(client.lastActiveAt()) >= h.presence.IdleTimeout()
+	client.idle.Store(idle)
+	status := models.UserStatusOnline
+	if idle {
+		status = models.UserStatusAway
+	}
+
+	change, err := h.presence.Report(context.Background(), client.UserID, client.SessionID, status)
+	if err != nil {
+		log.Printf("[Hub] Failed to report presence of user %d: %v", client.UserID, err)
+		return
+	}
+	h.AnnouncePresence(change)
+}
+
+// disconnectPresence removes a closed connection from presence; the user goes offline
+// once none of their connections on any server remain
+func (h *Hub) disconnectPresence(client *Client) {
+	if h.presence == nil {
+		return
+	}
+
+	change, err := h.presence.Disconnect(context.Background(), client.UserID, client.SessionID)
+	if err != nil {
+		log.Printf("[Hub] Failed to remove presence of user %d: %v", client.UserID, err)
+		return
 	}
+	h.AnnouncePresence(change)
+}
 
+// UserConnectionCount returns the number of local connections (devices) of a user
+func (h *Hub) UserConnectionCount(userID uint64) int {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
+	return len(h.userConns[userID])
+}
 
-	for client := range h.clients {
-		if client.UserID != userID {
-			if data, err := marshalMessage(msg); err == nil {
-				select {
-				case client.send <- data:
-				default:
-				}
-			}
-		}
+// BroadcastPresence sends a status change to every connection of the audience on all servers
+func (h *Hub) BroadcastPresence(change *models.PresenceChange, audience []uint64) {
+	data, err := marshalMessage(&WSMessage{
+		Type: TypePresenceUpdate,
+		Payload: PresenceUpdatePayload{
+			UserID: change.UserID,
+			Status: change.Status,
+		},
+		Timestamp: time.Now(),
+	})
+	if err != nil {
+		return
 	}
 
-	// Publish to Redis for other servers
-	if h.pubsub != nil {
-		if err := h.pubsub.PublishPresence(context.Background(), userID, status); err != nil {
-			log.Printf("Failed to publish presence to Redis: %v", err)
-		}
+	for _, userID := range audience {
+		h.SendToUser(userID, data)
 	}
 }
 
@@ -325,7 +436,159 @@ func (h *Hub) SendRoomInvite(userID uint64, room interface {
 		Timestamp: time.Now(),
 	}
 
+	h.SendUserEvent(userID, msg)
+}
+
+// BroadcastMembershipChanged notifies the room and the affected user, on all servers, that the
+// user was added to, removed from or left the room, or had their role changed. The affected user may receive it twice;
+// clients drop events whose seq they already saw.
+func (h *Hub) BroadcastMembershipChanged(roomID, userID uint64, action string) {
+	msg := &WSMessage{
+		Type: TypeMembershipChanged,
+		Payload: MembershipChangedPayload{
+			RoomID: roomID,
+			UserID: userID,
+			Action: action,
+		},
+		Timestamp: time.Now(),
+	}
+
+	h.recordEvent(msg, roomID, userID)
+
 	if data, err := marshalMessage(msg); err == nil {
+		h.BroadcastToRoom(roomID, data, nil)
 		h.SendToUser(userID, data)
 	}
 }
+
+// BroadcastNewMessage delivers a stored message to everyone in the room, on all servers
+func (h *Hub) BroadcastNewMessage(message *models.MessageResponse) {
+	msg := &WSMessage{
+		Type: TypeNewMessage,
+		Payload: NewMessagePayload{
+			ID:              message.ID,
+			RoomID:          message.RoomID,
+			Sender:          message.Sender,
+			ClientMessageID: message.ClientMessageID,
+			Content:         message.Content,
+			MessageType:     message.MessageType,
+			FileURL:         message.FileURL,
+			ThumbnailURL:    message.ThumbnailURL,
+			Metadata:        message.Metadata,
+			ParentID:        message.ParentID,
+			ReplyTo:         message.ReplyTo,
+			CreatedAt:       message.CreatedAt,
+			UnreadCount:     message.UnreadCount,
+		},
+		Timestamp: time.Now(),
+	}
+
+	h.BroadcastRoomEvent(message.RoomID, msg, nil)
+}
+
+// BroadcastOwnershipTransferred notifies the room, on all servers, of a new owner
+// followed by the system message recording it
+func (h *Hub) BroadcastOwnershipTransferred(transfer *models.OwnershipTransfer) {
+	msg := &WSMessage{
+		Type: TypeOwnershipTransferred,
+		Payload: OwnershipTransferredPayload{
+			RoomID:          transfer.RoomID,
+			PreviousOwnerID: transfer.PreviousOwnerID,
+			NewOwnerID:      transfer.NewOwnerID,
+		},
+		Timestamp: time.Now(),
+	}
+
+	h.BroadcastRoomEvent(transfer.RoomID, msg, nil)
+
+	if transfer.SystemMessage != nil {
+		h.BroadcastNewMessage(transfer.SystemMessage)
+	}
+}
+
+// BroadcastMessagePinned notifies everyone in the room, on all servers, of a new pin
+func (h *Hub) BroadcastMessagePinned(pin *models.PinnedMessageResponse) {
+	msg := &WSMessage{
+		Type: TypeMessagePinned,
+		Payload: MessagePinnedPayload{
+			RoomID:   pin.Message.RoomID,
+			Message:  pin.Message,
+			PinnedBy: pin.PinnedBy,
+			PinnedAt: pin.PinnedAt,
+		},
+		Timestamp: time.Now(),
+	}
+
+	h.BroadcastRoomEvent(pin.Message.RoomID, msg, nil)
+}
+
+// BroadcastMessageUnpinned notifies everyone in the room, on all servers, that a pin was removed
+func (h *Hub) BroadcastMessageUnpinned(roomID, messageID, unpinnedBy uint64) {
+	msg := &WSMessage{
+		Type: TypeMessageUnpinned,
+		Payload: MessageUnpinnedPayload{
+			RoomID:     roomID,
+			MessageID:  messageID,
+			UnpinnedBy: unpinnedBy,
+		},
+		Timestamp: time.Now(),
+	}
+
+	h.BroadcastRoomEvent(roomID, msg, nil)
+}
+
+// SendMentions notifies each mentioned user, on all servers, of the message that mentioned them
+func (h *Hub) SendMentions(message *models.MessageResponse) {
+	for _, userID := range message.MentionedUserIDs {
+		h.SendUserEvent(userID, &WSMessage{
+			Type: TypeMention,
+			Payload: MentionPayload{
+				RoomID:  message.RoomID,
+				Message: message,
+			},
+			Timestamp: time.Now(),
+		})
+	}
+}
+
+// BroadcastReactionUpdate notifies everyone in the room, on all servers, of a reaction change
+func (h *Hub) BroadcastReactionUpdate(update *models.ReactionUpdate) {
+	msg := &WSMessage{
+		Type:      TypeReactionUpdated,
+		Payload:   update,
+		Timestamp: time.Now(),
+	}
+
+	h.BroadcastRoomEvent(update.RoomID, msg, nil)
+}
+
+// BroadcastMessageUpdated notifies everyone in the room, on all servers, of an edited message
+func (h *Hub) BroadcastMessageUpdated(message *models.MessageResponse) {
+	msg := &WSMessage{
+		Type: TypeMessageUpdated,
+		Payload: MessageUpdatedPayload{
+			RoomID:    message.RoomID,
+			MessageID: message.ID,
+			Content:   message.Content,
+			IsEdited:  message.IsEdited,
+			EditedAt:  message.EditedAt,
+		},
+		Timestamp: time.Now(),
+	}
+
+	h.BroadcastRoomEvent(message.RoomID, msg, nil)
+}
+
+// BroadcastMessageDeleted notifies everyone in the room, on all servers, of a deleted message
+func (h *Hub) BroadcastMessageDeleted(roomID, messageID uint64) {
+	msg := &WSMessage{
+		Type: TypeMessageDeleted,
+		Payload: MessageDeletedPayload{
+			RoomID:    roomID,
+			MessageID: messageID,
+		},
+		Timestamp: time.Now(),
+	}
+
+	h.BroadcastRoomEvent(roomID, msg, nil)
+}
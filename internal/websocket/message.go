@@ -1,6 +1,7 @@
 package websocket
 
 import (
+	"encoding/json"
 	"time"
 
 	"Mmessenger/internal/models"
@@ -17,19 +18,43 @@ const (
 	TypeMarkRead    MessageType = "mark_read"
 	TypePing        MessageType = "ping"
 
+	TypeAddReaction    MessageType = "add_reaction"
+	TypeRemoveReaction MessageType = "remove_reaction"
+	TypeEditMessage    MessageType = "edit_message"
+	TypeDeleteMessage  MessageType = "delete_message"
+	TypeResume         MessageType = "resume"
+
 	// Server -> Client
-	TypeNewMessage        MessageType = "new_message"
-	TypeMessageRead       MessageType = "message_read"
-	TypeUserJoined        MessageType = "user_joined"
-	TypeUserLeft          MessageType = "user_left"
-	TypeUserTyping        MessageType = "user_typing"
-	TypePresenceUpdate    MessageType = "presence_update"
-	TypeError             MessageType = "error"
-	TypePong              MessageType = "pong"
-	TypeRoomJoined        MessageType = "room_joined"
-	TypeRoomLeft          MessageType = "room_left"
-	TypeRoomInvited       MessageType = "room_invited"
-	TypeUnreadCountUpdate MessageType = "unread_count_update"
+	TypeNewMessage           MessageType = "new_message"
+	TypeMessageRead          MessageType = "message_read"
+	TypeUserTyping           MessageType = "user_typing"
+	TypePresenceUpdate       MessageType = "presence_update"
+	TypeError                MessageType = "error"
+	TypePong                 MessageType = "pong"
+	TypeRoomJoined           MessageType = "room_joined"
+	TypeRoomLeft             MessageType = "room_left"
+	TypeRoomInvited          MessageType = "room_invited"
+	TypeUnreadCountUpdate    MessageType = "unread_count_update"
+	TypeReactionUpdated      MessageType = "reaction_updated"
+	TypeMessageUpdated       MessageType = "message_updated"
+	TypeMessageDeleted       MessageType = "message_deleted"
+	TypeAck                  MessageType = "ack"
+	TypeMembershipChanged    MessageType = "membership_changed"
+	TypeResumed              MessageType = "resumed"
+	TypeResyncRequired       MessageType = "resync_required"
+	TypeOwnershipTransferred MessageType = "ownership_transferred"
+	TypeMessagePinned        MessageType = "message_pinned"
+	TypeMessageUnpinned      MessageType = "message_unpinned"
+	TypeMention              MessageType = "mention"
+)
+
+// Membership change actions
+const (
+	MembershipAdded    = "added"
+	MembershipRemoved  = "removed"
+	MembershipLeft     = "left"
+	MembershipPromoted = "promoted"
+	MembershipDemoted  = "demoted"
 )
 
 type RoomInvitedPayload struct {
@@ -49,6 +74,8 @@ type WSMessage struct {
 	Payload   interface{} `json:"payload,omitempty"`
 	Timestamp time.Time   `json:"timestamp"`
 	RequestID string      `json:"request_id,omitempty"`
+	// Seq is set on events kept for replay; clients resume from the highest one they saw
+	Seq uint64 `json:"seq,omitempty"`
 }
 
 // Payload types for client messages
@@ -66,6 +93,9 @@ type SendMessagePayload struct {
 	MessageType  models.MessageType `json:"message_type"`
 	FileURL      string             `json:"file_url,omitempty"`
 	ThumbnailURL string             `json:"thumbnail_url,omitempty"`
+	ParentID     uint64             `json:"parent_id,omitempty"`
+	// ClientMessageID makes resends idempotent; the stored message is acked again instead of duplicated
+	ClientMessageID string `json:"client_message_id,omitempty"`
 }
 
 type TypingPayload struct {
@@ -73,6 +103,28 @@ type TypingPayload struct {
 	IsTyping bool   `json:"is_typing"`
 }
 
+type ReactionPayload struct {
+	RoomID    uint64 `json:"room_id"`
+	MessageID uint64 `json:"message_id"`
+	Emoji     string `json:"emoji"`
+}
+
+type EditMessagePayload struct {
+	RoomID    uint64 `json:"room_id"`
+	MessageID uint64 `json:"message_id"`
+	Content   string `json:"content"`
+}
+
+type DeleteMessagePayload struct {
+	RoomID    uint64 `json:"room_id"`
+	MessageID uint64 `json:"message_id"`
+}
+
+// ResumePayload is sent after (re)connecting to replay missed events
+type ResumePayload struct {
+	LastSeq uint64 `json:"last_seq"`
+}
+
 type MarkReadPayload struct {
 	RoomID    uint64 `json:"room_id"`
 	MessageID uint64 `json:"message_id"`
@@ -80,34 +132,89 @@ type MarkReadPayload struct {
 
 // Payload types for server messages
 type NewMessagePayload struct {
-	ID           uint64               `json:"id"`
-	RoomID       uint64               `json:"room_id"`
-	Sender       *models.UserResponse `json:"sender"`
-	Content      string               `json:"content"`
-	MessageType  models.MessageType   `json:"message_type"`
-	FileURL      *string              `json:"file_url,omitempty"`
-	ThumbnailURL *string              `json:"thumbnail_url,omitempty"`
-	CreatedAt    time.Time            `json:"created_at"`
-	UnreadCount  int                  `json:"unread_count"`
+	ID              uint64                 `json:"id"`
+	RoomID          uint64                 `json:"room_id"`
+	Sender          *models.UserResponse   `json:"sender"`
+	ClientMessageID string                 `json:"client_message_id,omitempty"`
+	Content         string                 `json:"content"`
+	MessageType     models.MessageType     `json:"message_type"`
+	FileURL         *string                `json:"file_url,omitempty"`
+	ThumbnailURL    *string                `json:"thumbnail_url,omitempty"`
+	Metadata        json.RawMessage        `json:"metadata,omitempty"`
+	ParentID        *uint64                `json:"parent_id,omitempty"`
+	ReplyTo         *models.MessagePreview `json:"reply_to,omitempty"`
+	CreatedAt       time.Time              `json:"created_at"`
+	UnreadCount     int                    `json:"unread_count"`
+}
+
+type MessageUpdatedPayload struct {
+	RoomID    uint64     `json:"room_id"`
+	MessageID uint64     `json:"message_id"`
+	Content   string     `json:"content"`
+	IsEdited  bool       `json:"is_edited"`
+	EditedAt  *time.Time `json:"edited_at"`
+}
+
+type MessageDeletedPayload struct {
+	RoomID    uint64 `json:"room_id"`
+	MessageID uint64 `json:"message_id"`
 }
 
-type MessageReadPayload struct {
-	RoomID      uint64 `json:"room_id"`
-	UserID      uint64 `json:"user_id"`
-	Username    string `json:"username"`
+type MessagePinnedPayload struct {
+	RoomID   uint64                  `json:"room_id"`
+	Message  *models.MessageResponse `json:"message"`
+	PinnedBy *models.UserResponse    `json:"pinned_by"`
+	PinnedAt time.Time               `json:"pinned_at"`
 }
 
-type UserJoinedPayload struct {
-	RoomID      uint64               `json:"room_id"`
-	User        *models.UserResponse `json:"user"`
-	MemberCount int                  `json:"member_count"`
+// MessageUnpinnedPayload reports a removed pin; UnpinnedBy is 0 when the pin went away
+// because the message was deleted
+type MessageUnpinnedPayload struct {
+	RoomID     uint64 `json:"room_id"`
+	MessageID  uint64 `json:"message_id"`
+	UnpinnedBy uint64 `json:"unpinned_by,omitempty"`
 }
 
-type UserLeftPayload struct {
-	RoomID      uint64 `json:"room_id"`
-	UserID      uint64 `json:"user_id"`
-	Username    string `json:"username"`
-	MemberCount int    `json:"member_count"`
+// MentionPayload tells a user they were mentioned; Message.Mentions says how
+type MentionPayload struct {
+	RoomID  uint64                  `json:"room_id"`
+	Message *models.MessageResponse `json:"message"`
+}
+
+// AckPayload confirms a client request; the request_id is echoed on the envelope
+type AckPayload struct {
+	MessageID       uint64 `json:"message_id,omitempty"`
+	ClientMessageID string `json:"client_message_id,omitempty"`
+}
+
+type OwnershipTransferredPayload struct {
+	RoomID          uint64 `json:"room_id"`
+	PreviousOwnerID uint64 `json:"previous_owner_id"`
+	NewOwnerID      uint64 `json:"new_owner_id"`
+}
+
+type MembershipChangedPayload struct {
+	RoomID uint64 `json:"room_id"`
+	UserID uint64 `json:"user_id"`
+	Action string `json:"action"`
+}
+
+// ResumedPayload ends a replay; LastSeq is the sequence to resume from next time
+type ResumedPayload struct {
+	LastSeq  uint64 `json:"last_seq"`
+	Replayed int    `json:"replayed"`
+}
+
+// ResyncRequiredPayload asks the client to reload its state over REST and continue from LastSeq
+type ResyncRequiredPayload struct {
+	LastSeq uint64 `json:"last_seq"`
+}
+
+type MessageReadPayload struct {
+	RoomID            uint64 `json:"room_id"`
+	UserID            uint64 `json:"user_id"`
+	Username          string `json:"username"`
+	LastReadMessageID uint64 `json:"last_read_message_id"`
 }
 
 type UserTypingPayload struct {
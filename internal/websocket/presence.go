@@ -0,0 +1,84 @@
+package websocket
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"Mmessenger/internal/models"
+)
+
+// presenceCoalesceWindow is how long a status change waits before it is announced, so a
+// user who reconnects quickly doesn't flicker offline and back online for everyone
+const presenceCoalesceWindow = 3 * time.Second
+
+// presenceCoalescer folds the status changes of a user within a window into one flush
+type presenceCoalescer struct {
+	window  time.Duration
+	flush   func(userID uint64)
+	mu      sync.Mutex
+	pending map[uint64]bool
+}
+
+func newPresenceCoalescer(window time.Duration, flush func(userID uint64)) *presenceCoalescer {
+	return &presenceCoalescer{
+		window:  window,
+		flush:   flush,
+		pending: make(map[uint64]bool),
+	}
+}
+
+// add schedules a flush of the user once the window has passed, unless one is already
+// scheduled
+func (c *presenceCoalescer) add(userID uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.pending[userID] {
+		return
+	}
+	c.pending[userID] = true
+	time.AfterFunc(c.window, func() {
+		c.mu.Lock()
+		delete(c.pending, userID)
+		c.mu.Unlock()
+
+		c.flush(userID)
+	})
+}
+
+// AnnouncePresence schedules a status change to be announced once the coalescing window has
+// passed. Further changes of the same user in the window are folded into that announcement,
+// which carries the user's status at the time; a nil change is ignored.
+func (h *Hub) AnnouncePresence(change *models.PresenceChange) {
+	if change == nil {
+		return
+	}
+	h.presenceCoalescer.add(change.UserID)
+}
+
+// flushPresence announces the user's current status to their connected room peers, unless
+// it is the status some server announced last
+func (h *Hub) flushPresence(userID uint64) {
+	if h.presence == nil {
+		return
+	}
+
+	ctx := context.Background()
+	change, err := h.presence.Announce(ctx, userID)
+	if err != nil {
+		log.Printf("[Hub] Failed to announce presence of user %d: %v", userID, err)
+		return
+	}
+	if change == nil {
+		return
+	}
+
+	audience, err := h.presence.Audience(ctx, userID)
+	if err != nil {
+		log.Printf("[Hub] Failed to find presence audience of user %d: %v", userID, err)
+		return
+	}
+	h.BroadcastPresence(change, audience)
+}
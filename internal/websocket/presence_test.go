@@ -0,0 +1,74 @@
+package websocket
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPresenceCoalescer(t *testing.T) {
+	const window = 20 * time.Millisecond
+
+	tests := []struct {
+		name  string
+		adds  []uint64
+		again bool // add them all again once the window has passed
+		want  map[uint64]int
+	}{
+		{
+			name: "single change",
+			adds: []uint64{1},
+			want: map[uint64]int{1: 1},
+		},
+		{
+			name: "flapping user is flushed once",
+			adds: []uint64{1, 1, 1, 1},
+			want: map[uint64]int{1: 1},
+		},
+		{
+			name: "users are coalesced separately",
+			adds: []uint64{1, 2, 1, 2, 3},
+			want: map[uint64]int{1: 1, 2: 1, 3: 1},
+		},
+		{
+			name:  "change after the window is flushed again",
+			adds:  []uint64{1, 1},
+			again: true,
+			want:  map[uint64]int{1: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			got := make(map[uint64]int)
+			c := newPresenceCoalescer(window, func(userID uint64) {
+				mu.Lock()
+				got[userID]++
+				mu.Unlock()
+			})
+
+			for _, userID := range tt.adds {
+				c.add(userID)
+			}
+			if tt.again {
+				time.Sleep(3 * window)
+				for _, userID := range tt.adds {
+					c.add(userID)
+				}
+			}
+			time.Sleep(3 * window)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(got) != len(tt.want) {
+				t.Fatalf("flushed %v, want %v", got, tt.want)
+			}
+			for userID, want := range tt.want {
+				if got[userID] != want {
+					t.Errorf("user %d flushed %d times, want %d", userID, got[userID], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package websocket
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"Mmessenger/internal/pubsub"
+)
+
+// subscriptions reference-counts the broker channels this server's clients need. A channel
+// is subscribed when its first reference is taken and unsubscribed when the last is released,
+// so the server only receives traffic for rooms and users it has connections for.
+type subscriptions struct {
+	broker pubsub.Broker
+	mu     sync.Mutex
+	refs   map[string]int
+}
+
+func newSubscriptions(broker pubsub.Broker) *subscriptions {
+	return &subscriptions{
+		broker: broker,
+		refs:   make(map[string]int),
+	}
+}
+
+func (s *subscriptions) acquire(channels ...string) {
+	if s.broker == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var added []string
+	for _, channel := range channels {
+		s.refs[channel]++
+		if s.refs[channel] == 1 {
+			added = append(added, channel)
+		}
+	}
+	if len(added) == 0 {
+		return
+	}
+	if err := s.broker.Subscribe(context.Background(), added...); err != nil {
+		log.Printf("[Hub] Failed to subscribe to %v: %v", added, err)
+	}
+}
+
+func (s *subscriptions) release(channels ...string) {
+	if s.broker == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var removed []string
+	for _, channel := range channels {
+		if s.refs[channel] == 0 {
+			continue
+		}
+		s.refs[channel]--
+		if s.refs[channel] == 0 {
+			delete(s.refs, channel)
+			removed = append(removed, channel)
+		}
+	}
+	if len(removed) == 0 {
+		return
+	}
+	if err := s.broker.Unsubscribe(context.Background(), removed...); err != nil {
+		log.Printf("[Hub] Failed to unsubscribe from %v: %v", removed, err)
+	}
+}